@@ -0,0 +1,458 @@
+package goworker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cihub/seelog"
+	"golang.org/x/net/context"
+)
+
+// Client is a goworker instance with its own settings,
+// Redis connection pool, registry of worker functions and
+// logger. Several clients may run in one process, e.g. to
+// consume different Redis databases or namespaces.
+//
+// The package-level functions such as Register, Work and
+// Enqueue operate on a default client configured by the
+// command line flags and SetSettings.
+type Client struct {
+	settings   *WorkerSettings
+	parseFlags bool
+
+	logger    Logger
+	sentinel  *Sentinel
+	ctx       context.Context
+	workers   map[string]Handler
+	retries   map[string]RetryPolicy
+	schedules map[string]*Schedule
+	done      chan struct{}
+
+	// middleware runs around every job, classMiddleware
+	// around the jobs of a class
+	middleware      []Middleware
+	classMiddleware map[string][]Middleware
+
+	hooks       []Hooks
+	classHooks  map[string][]Hooks
+	workerHooks []WorkerHooks
+
+	metrics     *metrics
+	metricsOnce sync.Once
+
+	// processes holds the ids of the open processes, whose
+	// heartbeats are refreshed
+	processes      map[string]bool
+	processesMutex sync.Mutex
+
+	// resumed is closed on resume and nil unless paused
+	resumed    chan struct{}
+	pauseMutex sync.Mutex
+
+	// cancelled counts the jobs cancelled by the last
+	// shutdown of Work
+	cancelled int32
+
+	// inflightToken tells the in-flight lists of the
+	// current run of Work apart, see reliable.go
+	inflightToken string
+
+	initMutex   sync.Mutex
+	initialized bool
+}
+
+// NewClient creates a client from the given settings. The
+// command line flags do not apply to it. QueuesString and
+// IntervalFloat are interpreted the same way as the
+// -queues and -interval flags, and zero fields get the
+// defaults of the flags.
+func NewClient(settings WorkerSettings) *Client {
+	return newClient(&settings, false)
+}
+
+func newClient(settings *WorkerSettings, parseFlags bool) *Client {
+	c := &Client{
+		settings:   settings,
+		parseFlags: parseFlags,
+		workers:    make(map[string]Handler),
+		retries:    make(map[string]RetryPolicy),
+		schedules:  make(map[string]*Schedule),
+		processes:  make(map[string]bool),
+
+		classMiddleware: make(map[string][]Middleware),
+		classHooks:      make(map[string][]Hooks),
+	}
+	c.logger = settings.Logger
+	if c.logger == nil {
+		c.logger = defaultLogger()
+	}
+	return c
+}
+
+// defaultLogger logs to standard output at the info level.
+func defaultLogger() Logger {
+	logger, err := seelog.LoggerFromWriterWithMinLevel(os.Stdout, seelog.InfoLvl)
+	if err != nil {
+		return SeelogLogger(seelog.Default)
+	}
+	return SeelogLogger(logger)
+}
+
+// Namespace returns the Redis namespace of the client.
+func (c *Client) Namespace() string {
+	return c.settings.Namespace
+}
+
+// Init initializes the client. This will be called by the
+// Work and Enqueue methods, but may be used by programs that
+// wish to access the connection pool without actually
+// processing jobs.
+func (c *Client) Init() error {
+	c.initMutex.Lock()
+	defer c.initMutex.Unlock()
+	if !c.initialized {
+		// the settings of the default client may be replaced
+		// after it is created
+		if c.settings.Logger != nil {
+			c.logger = c.settings.Logger
+		}
+
+		if c.parseFlags {
+			if err := flags(); err != nil {
+				return err
+			}
+		}
+		if err := c.settings.parse(); err != nil {
+			return err
+		}
+		if !c.settings.UseNumber {
+			c.logger.Warn("DEPRECATION WARNING: encoding/json decodes numbers as float64, which can lose precision as they are read from the Resque queue. Set the -use-number flag to use json.Number when decoding numbers and remove this warning.")
+		}
+		c.ctx = context.Background()
+
+		var err error
+		c.sentinel, err = NewSentinel(
+			c.settings.URI,
+			c.settings.Connections,
+			c.settings.Connections,
+			c.settings.Timeout,
+		)
+		if err != nil {
+			return err
+		}
+
+		tlsConfig, err := c.settings.tlsConfig()
+		if err != nil {
+			return err
+		}
+		c.sentinel.SetTLSConfig(tlsConfig)
+		c.sentinel.SetCredentials(c.settings.RedisUsername, c.settings.RedisPassword)
+		c.sentinel.SetSentinelCredentials(c.settings.SentinelUsername, c.settings.SentinelPassword)
+
+		c.done = make(chan struct{})
+		go c.discover(c.sentinel, c.done)
+
+		c.initialized = true
+	}
+	return nil
+}
+
+func (c *Client) discover(sentinel *Sentinel, done <-chan struct{}) {
+	for {
+		if err := sentinel.Discover(); err != nil {
+			c.logger.Error("Sentinel discovery failed", "error", err)
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+// GetConn returns a connection from the Redis connection
+// pool of the client. When using the pool, check in
+// connections as quickly as possible, because holding a
+// connection will cause concurrent worker functions to
+// lock while they wait for an available connection.
+//
+// The connection pool holds connections to a specific
+// master which might go down or be demoted to slave. If
+// either happens, the connection is closed and removed
+// from the pool which will provide a brand new connection
+// when asked. GetConn tries to get a new connection
+// several times and only if no attempt succeeds, it
+// returns the error.
+func (c *Client) GetConn() (*RedisConn, error) {
+	deadConnection := errors.New("Dead connection")
+	slaveConnection := errors.New("Stale connection (to slave, not master)")
+	try := func() (*RedisConn, error) {
+		start := time.Now()
+		conn, err := c.sentinel.GetConn(c.ctx)
+		c.stats().poolWait.Observe(time.Since(start).Seconds())
+		if err != nil {
+			return nil, err
+		}
+
+		// close the connection and remove it from the pool so that new
+		// connections get created
+
+		// if the instance does not ping back
+		_, err = conn.Do("ping")
+		if err != nil {
+			conn.Close()
+			c.PutConn(nil)
+			return nil, deadConnection
+		}
+
+		// or if the instance is not a master anymore
+		role, err := role(conn.Do("role"))
+		if err != nil {
+			return nil, err
+		}
+		if role != "master" {
+			conn.Close()
+			c.PutConn(nil)
+			c.stats().failovers.Inc()
+			return nil, slaveConnection
+		}
+		return conn, nil
+	}
+
+	// always try at least once, so that a connection or an
+	// error is returned
+	retries := c.settings.ConnectionRetries
+	if retries < 1 {
+		retries = 1
+	}
+
+	var conn *RedisConn
+	var err error
+	for i := 0; i < retries; i++ {
+		if i > 0 {
+			c.stats().connRetries.Inc()
+		}
+		if conn, err = try(); err == nil {
+			return conn, nil
+		} else if err != slaveConnection && err != deadConnection {
+			if err, ok := err.(net.Error); ok && !err.Timeout() {
+				return nil, err
+			}
+		}
+	}
+
+	return conn, err
+}
+
+func (c *Client) isInitialized() bool {
+	c.initMutex.Lock()
+	defer c.initMutex.Unlock()
+	return c.initialized
+}
+
+// initConn initializes the client and gets a connection
+// for the inspection and management APIs.
+func (c *Client) initConn() (*RedisConn, error) {
+	if err := c.Init(); err != nil {
+		return nil, err
+	}
+	conn, err := c.GetConn()
+	if err != nil {
+		c.logger.Error("Error on getting connection", "error", err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// PutConn puts a connection back into the connection pool
+// of the client. Run this as soon as you finish using a
+// connection that you got from GetConn.
+func (c *Client) PutConn(conn *RedisConn) {
+	c.sentinel.PutConn(untraced(conn))
+}
+
+// jobTimeout returns the longest time the job may run. The
+// timeout of its class takes precedence over the timeout of
+// its queue, which takes precedence over JobTimeout. Zero
+// means no limit.
+func (c *Client) jobTimeout(job *Job) time.Duration {
+	if timeout, ok := c.settings.ClassTimeouts[job.Payload.Class]; ok {
+		return timeout
+	}
+	if timeout, ok := c.settings.QueueTimeouts[job.Queue]; ok {
+		return timeout
+	}
+	return c.settings.JobTimeout
+}
+
+// Close cleans up resources initialized by the client.
+// This will be called by Work when cleaning up. However,
+// if you are using the Init method without calling Work,
+// you should run this method when cleaning up.
+func (c *Client) Close() {
+	c.initMutex.Lock()
+	defer c.initMutex.Unlock()
+	if c.initialized {
+		close(c.done)
+		c.sentinel.Close()
+		c.initialized = false
+	}
+}
+
+// Work starts processing jobs with the client. Check for
+// errors in the return value. Work will run until a QUIT,
+// INT, or TERM signal is received, or until the queues are
+// empty if ExitOnComplete is set.
+func (c *Client) Work() error {
+	return c.WorkContext(context.Background())
+}
+
+// WorkContext starts processing jobs with the client like
+// Work, and additionally stops polling when ctx is done.
+// Jobs that are already running may finish within the
+// ShutdownTimeout grace period. When it expires, they are
+// cancelled and either requeued or failed, depending on
+// ShutdownRequeue, and WorkContext returns an error. A zero
+// ShutdownTimeout waits for running jobs indefinitely.
+func (c *Client) WorkContext(ctx context.Context) error {
+	err := c.Init()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	quit := signals(ctx)
+	go c.pauseSignals(quit)
+
+	poller, err := newPoller(c, c.settings.Queues, c.settings.IsStrict)
+	if err != nil {
+		return err
+	}
+
+	conn, err := c.GetConn()
+	if err != nil {
+		return err
+	}
+	err = c.pruneDeadWorkers(conn)
+	c.PutConn(conn)
+	if err != nil {
+		return err
+	}
+	defer c.holdHeartbeat()()
+
+	// the lists of dead reliable workers are recovered even
+	// when this process does not run in reliable mode
+	conn, err = c.GetConn()
+	if err != nil {
+		return err
+	}
+	err = c.recoverInflight(conn)
+	c.PutConn(conn)
+	if err != nil {
+		return err
+	}
+
+	if c.settings.Reliable {
+		c.inflightToken = newInflightToken()
+		release := poller.holdInflight()
+		defer func() {
+			release()
+			conn, err := c.GetConn()
+			if err != nil {
+				c.logger.Error("Error on getting connection to release in-flight lists", poller.fields("error", err)...)
+				return
+			}
+			if err := poller.releaseInflight(conn); err != nil {
+				c.logger.Error("Error releasing in-flight lists", poller.fields("error", err)...)
+			}
+			c.PutConn(conn)
+		}()
+	}
+
+	if c.settings.Scheduler {
+		go c.schedule(c.settings.SchedulerInterval, quit)
+	} else if classes := c.delayedRetryClasses(); len(classes) > 0 {
+		c.logger.Warn("Retries with a backoff wait in the delayed queue, which only -scheduler or a Ruby resque-scheduler enqueues", "classes", classes)
+	}
+	if len(c.schedules) > 0 {
+		go c.cron(quit)
+	}
+
+	if c.settings.MetricsAddr != "" {
+		stopMetrics, err := c.serveMetrics(c.settings.MetricsAddr)
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+	}
+
+	c.workerHook(func(hooks WorkerHooks) {
+		if hooks.BeforeFirstFork != nil {
+			hooks.BeforeFirstFork()
+		}
+	})
+
+	jobs := poller.poll(time.Duration(c.settings.Interval), quit)
+
+	// jobs keep running after polling stops, until the grace
+	// period expires
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	atomic.StoreInt32(&c.cancelled, 0)
+
+	var monitor sync.WaitGroup
+
+	for id := 0; id < c.settings.Concurrency; id++ {
+		worker, err := newWorker(c, strconv.Itoa(id), c.settings.Queues)
+		if err != nil {
+			return err
+		}
+		worker.work(jobsCtx, jobs, &monitor)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		monitor.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-quit:
+	}
+
+	if c.settings.ShutdownTimeout <= 0 {
+		<-finished
+		return nil
+	}
+
+	select {
+	case <-finished:
+		return nil
+	case <-time.After(c.settings.ShutdownTimeout):
+	}
+
+	c.logger.Warn("Shutdown grace period expired, cancelling running jobs", "timeout", c.settings.ShutdownTimeout)
+	cancelJobs()
+	<-finished
+
+	action := "failed"
+	if c.settings.ShutdownRequeue {
+		action = "requeued"
+	}
+	return fmt.Errorf(
+		"shutdown grace period of %v expired, %d running jobs were cancelled and %s",
+		c.settings.ShutdownTimeout,
+		atomic.LoadInt32(&c.cancelled),
+		action,
+	)
+}
@@ -0,0 +1,113 @@
+package goworker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cihub/seelog"
+)
+
+func TestClientsAreIndependent(t *testing.T) {
+	first := NewClient(WorkerSettings{Namespace: "first:"})
+	second := NewClient(WorkerSettings{Namespace: "second:"})
+
+	first.Register("MyClass", func(queue string, args ...interface{}) error {
+		return nil
+	})
+
+	if _, ok := first.workers["MyClass"]; !ok {
+		t.Error("expected MyClass to be registered with the first client")
+	}
+	if _, ok := second.workers["MyClass"]; ok {
+		t.Error("did not expect MyClass to be registered with the second client")
+	}
+	if first.Namespace() != "first:" || second.Namespace() != "second:" {
+		t.Errorf("expected namespaces first: and second:, actual %s and %s", first.Namespace(), second.Namespace())
+	}
+}
+
+func TestDefaultClientUsesWorkerSettings(t *testing.T) {
+	defer func(namespace string) {
+		workerSettings.Namespace = namespace
+	}(workerSettings.Namespace)
+
+	workerSettings.Namespace = "custom:"
+	if Namespace() != "custom:" {
+		t.Errorf("expected namespace custom:, actual %s", Namespace())
+	}
+}
+
+func TestNewClientCopiesSettings(t *testing.T) {
+	settings := WorkerSettings{Namespace: "resque:"}
+	client := NewClient(settings)
+	settings.Namespace = "changed:"
+	if client.Namespace() != "resque:" {
+		t.Errorf("expected namespace resque:, actual %s", client.Namespace())
+	}
+}
+
+func TestClientJobTimeout(t *testing.T) {
+	client := NewClient(WorkerSettings{
+		JobTimeout:    time.Minute,
+		ClassTimeouts: timeoutsFlag{"Slow": time.Hour},
+		QueueTimeouts: timeoutsFlag{"high": time.Second},
+	})
+
+	for _, tt := range []struct {
+		class    string
+		queue    string
+		expected time.Duration
+	}{
+		{"Other", "low", time.Minute},
+		{"Other", "high", time.Second},
+		{"Slow", "low", time.Hour},
+		{"Slow", "high", time.Hour},
+	} {
+		job := &Job{Queue: tt.queue, Payload: Payload{Class: tt.class}}
+		if actual := client.jobTimeout(job); actual != tt.expected {
+			t.Errorf("%s on %s: expected %v, actual %v", tt.class, tt.queue, tt.expected, actual)
+		}
+	}
+}
+
+func TestSettingsParseDefaults(t *testing.T) {
+	settings := WorkerSettings{QueuesString: "high"}
+	if err := settings.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if settings.URI != defaultURI || settings.Namespace != defaultNamespace ||
+		settings.Concurrency != defaultConcurrency || settings.Connections != defaultConnections ||
+		settings.ConnectionRetries != defaultConnectionRetries || settings.Timeout != defaultTimeout ||
+		time.Duration(settings.Interval) != 5*time.Second {
+		t.Errorf("expected the defaults of the flags, actual %+v", settings)
+	}
+
+	settings = WorkerSettings{QueuesString: "high", Connections: -1}
+	if err := settings.parse(); err != errorNegativeSetting {
+		t.Errorf("expected %v, actual %v", errorNegativeSetting, err)
+	}
+}
+
+func TestClientInitTwice(t *testing.T) {
+	client := NewClient(WorkerSettings{QueuesString: "high=2,low", Logger: SeelogLogger(seelog.Disabled)})
+	for i := 0; i < 2; i++ {
+		if err := client.Init(); err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+	}
+	if actual := fmt.Sprint(client.settings.Queues); actual != "[high high low]" {
+		t.Errorf("expected [high high low], actual %s", actual)
+	}
+
+	settings := WorkerSettings{Queues: []string{"high", "low"}}
+	for i := 0; i < 2; i++ {
+		if err := settings.parse(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if actual := fmt.Sprint(settings.Queues); actual != "[high low]" {
+		t.Errorf("expected [high low], actual %s", actual)
+	}
+}
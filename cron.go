@@ -0,0 +1,239 @@
+package goworker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errorInvalidCron = errors.New("invalid cron expression, use 5 fields (minute hour day-of-month month day-of-week), @hourly or @every 5m")
+
+// cronSchedule returns the first tick strictly after t, or
+// the zero time if there is none.
+type cronSchedule interface {
+	next(t time.Time) time.Time
+}
+
+// cronSpec is a standard 5 field cron expression. Every
+// field is a bit set of the values it matches.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// like Vixie cron, when both days are restricted, a day
+	// matches either of them
+	domStar, dowStar bool
+	// like Vixie cron, jobs at fixed hours run once when the
+	// clocks change, see next
+	hourStar bool
+}
+
+// everySpec ticks at multiples of its interval since the
+// Unix epoch, so that all processes agree on the ticks.
+type everySpec struct {
+	every time.Duration
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{0, 59, nil}
+	hourField   = cronField{0, 23, nil}
+	domField    = cronField{1, 31, nil}
+	monthField  = cronField{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted for Sunday and folded onto 0
+	dowField = cronField{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseCron(spec string) (cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || every < time.Second {
+			return nil, errorInvalidCron
+		}
+		return &everySpec{every: every}, nil
+	}
+	if expanded, ok := cronDescriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errorInvalidCron
+	}
+
+	s := &cronSpec{}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	// like Vixie cron, a field starting with * is unrestricted
+	// even with a step, so that "*/2 * 1" means every other day
+	// which is a Monday
+	s.domStar = strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[2], "?")
+	s.dowStar = strings.HasPrefix(fields[4], "*") || strings.HasPrefix(fields[4], "?")
+	s.hourStar = strings.HasPrefix(fields[1], "*")
+	return s, nil
+}
+
+// parse turns a comma-separated list of values, ranges and
+// steps such as "*/15", "1-5" or "mon,wed" into a bit set.
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.IndexRune(part, '/'); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			low, high = f.min, f.max
+		case strings.ContainsRune(rangePart, '-'):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if low, err = f.value(rangePart); err != nil {
+				return 0, err
+			}
+			high = low
+			if step > 1 {
+				high = f.max
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range in cron field %q", field)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid cron value %q, expected %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// next walks the wall clock of the location of t. When the
+// clocks fall back, ticks of a fixed hour are skipped in the
+// repeated hour, and when they spring forward, ticks in the
+// skipped hour fall on the first minute after it.
+func (s *cronSpec) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// no expression needs more than the leap year cycle
+	limit := t.Year() + 5
+
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).AddDate(0, 0, 1)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		// advance the instant, as the start of the hour in the
+		// wall clock may be in the past when the clocks fall back
+		hour := t.Hour()
+		t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+		if !s.hourStar && t.Hour() > hour+1 && s.hour&(1<<uint(t.Hour())-1<<uint(hour+1)) != 0 {
+			return t
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	if !s.hourStar && t.Add(-time.Hour).Hour() == t.Hour() {
+		t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		goto wrap
+	}
+	return t
+}
+
+func (s *cronSpec) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s *everySpec) next(t time.Time) time.Time {
+	return t.Truncate(s.every).Add(s.every)
+}
@@ -0,0 +1,114 @@
+package goworker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"@every 0s",
+		"@every soon",
+		"@sometimes",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.UTC)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	for _, tt := range []struct {
+		spec     string
+		from     string
+		expected string
+	}{
+		{"* * * * *", "2017-03-25 10:15:30", "2017-03-25 10:16:00"},
+		{"*/5 * * * *", "2017-03-25 10:15:00", "2017-03-25 10:20:00"},
+		{"*/5 * * * *", "2017-03-25 10:14:59", "2017-03-25 10:15:00"},
+		{"0 * * * *", "2017-03-25 10:15:00", "2017-03-25 11:00:00"},
+		{"@hourly", "2017-03-25 23:15:00", "2017-03-26 00:00:00"},
+		{"30 2 * * *", "2017-03-25 10:15:00", "2017-03-26 02:30:00"},
+		{"0 0 1 * *", "2017-12-15 00:00:00", "2018-01-01 00:00:00"},
+		{"0 0 29 2 *", "2017-03-25 00:00:00", "2020-02-29 00:00:00"},
+		{"0 9 * * mon-fri", "2017-03-25 10:00:00", "2017-03-27 09:00:00"},
+		{"0 9 * * 7", "2017-03-25 10:00:00", "2017-03-26 09:00:00"},
+		{"0 0 1 * mon", "2017-03-25 00:00:00", "2017-03-27 00:00:00"},
+		{"0 0 */2 * 1", "2017-03-27 12:00:00", "2017-04-03 00:00:00"},
+		{"0 0 1-31/2 * 1", "2017-03-27 12:00:00", "2017-03-29 00:00:00"},
+		{"0 12 * jun,dec *", "2017-03-25 00:00:00", "2017-06-01 12:00:00"},
+		{"@every 5m", "2017-03-25 10:12:00", "2017-03-25 10:15:00"},
+		{"@every 5m", "2017-03-25 10:15:00", "2017-03-25 10:20:00"},
+	} {
+		schedule, err := parseCron(tt.spec)
+		if err != nil {
+			t.Errorf("%q: did not expect an error, got %v", tt.spec, err)
+			continue
+		}
+		actual := schedule.next(at(tt.from))
+		if !actual.Equal(at(tt.expected)) {
+			t.Errorf("%q from %s: expected %s, actual %s", tt.spec, tt.from, tt.expected, actual)
+		}
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, loc)
+	}
+	// the clocks fall back from 2:00 EDT to 1:00 EST on November 1
+	// and spring forward from 2:00 EST to 3:00 EDT on March 8
+	repeated := at(time.November, 1, 1, 0).Add(time.Hour)
+
+	for _, tt := range []struct {
+		spec     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"0 9 * * *", at(time.October, 31, 9, 0), at(time.November, 1, 9, 0)},
+		{"30 1 * * *", at(time.November, 1, 0, 0), at(time.November, 1, 1, 30)},
+		{"30 1 * * *", at(time.November, 1, 1, 30), at(time.November, 2, 1, 30)},
+		{"0 2 * * *", at(time.November, 1, 1, 30), repeated.Add(time.Hour)},
+		{"*/30 * * * *", at(time.November, 1, 1, 30), repeated},
+		{"0 9 * * *", at(time.March, 7, 9, 0), at(time.March, 8, 9, 0)},
+		{"30 2 * * *", at(time.March, 8, 0, 0), at(time.March, 8, 3, 0)},
+		{"30 2 * * *", at(time.March, 8, 3, 0), at(time.March, 9, 2, 30)},
+		{"*/30 * * * *", at(time.March, 8, 1, 30), at(time.March, 8, 3, 0)},
+	} {
+		schedule, err := parseCron(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan time.Time, 1)
+		go func() { done <- schedule.next(tt.from) }()
+		select {
+		case actual := <-done:
+			if !actual.Equal(tt.expected) {
+				t.Errorf("%q from %s: expected %s, actual %s", tt.spec, tt.from, tt.expected, actual)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q from %s: did not return", tt.spec, tt.from)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package goworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// delayedItem is a job scheduled in the format of
+// resque-scheduler. The items are stored in the lists
+//
+//	resque:delayed:<timestamp>
+//
+// whose timestamps are members of the sorted set
+// resque:delayed_queue_schedule, scored by the timestamp.
+// Every item is also indexed by the set
+// resque:timestamps:<item> so that it can be found and
+// removed again. The items carry no trace context, as any
+// extra field would keep resque-scheduler from finding them,
+// so delayed jobs and retries start new traces.
+type delayedItem struct {
+	Class string        `json:"class"`
+	Args  []interface{} `json:"args"`
+	Queue string        `json:"queue"`
+}
+
+// encodeDelayedItem encodes the job the same way Ruby's
+// JSON does, so that resque-scheduler finds the same item
+// under the same timestamps key.
+func encodeDelayedItem(job *Job) ([]byte, error) {
+	item := delayedItem{
+		Class: job.Payload.Class,
+		Args:  job.Payload.Args,
+		Queue: job.Queue,
+	}
+	if item.Args == nil {
+		item.Args = []interface{}{}
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(item); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buffer.Bytes(), "\n"), nil
+}
+
+// delayedPush schedules the job to be enqueued at the given
+// time. The commands are sent in a transaction, the caller
+// flushes them.
+func (c *Client) delayedPush(conn *RedisConn, at time.Time, job *Job) error {
+	item, err := encodeDelayedItem(job)
+	if err != nil {
+		return err
+	}
+	timestamp := at.Unix()
+
+	conn.Send("MULTI")
+	conn.Send("RPUSH", fmt.Sprintf("%sdelayed:%d", c.Namespace(), timestamp), item)
+	conn.Send("SADD", fmt.Sprintf("%stimestamps:%s", c.Namespace(), item), fmt.Sprintf("delayed:%d", timestamp))
+	conn.Send("ZADD", fmt.Sprintf("%sdelayed_queue_schedule", c.Namespace()), timestamp, timestamp)
+	return conn.Send("EXEC")
+}
@@ -0,0 +1,145 @@
+package goworker
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestEncodeDelayedItem(t *testing.T) {
+	for _, tt := range []struct {
+		job      Job
+		expected string
+	}{
+		{
+			Job{Queue: "high", Payload: Payload{Class: "MyClass", Args: []interface{}{"<a>", 1}}},
+			`{"class":"MyClass","args":["<a>",1],"queue":"high"}`,
+		},
+		{
+			Job{Queue: "high", Payload: Payload{Class: "MyClass"}},
+			`{"class":"MyClass","args":[],"queue":"high"}`,
+		},
+		{
+			Job{Queue: "high", Payload: Payload{Class: "MyClass", TraceContext: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}},
+			`{"class":"MyClass","args":[],"queue":"high"}`,
+		},
+	} {
+		actual, err := encodeDelayedItem(&tt.job)
+		if err != nil {
+			t.Errorf("%#v: error %v", tt.job, err)
+		} else if string(actual) != tt.expected {
+			t.Errorf("%#v: expected %s, actual %s", tt.job, tt.expected, actual)
+		}
+	}
+}
+
+func TestDecodeDelayedItem(t *testing.T) {
+	for _, tt := range []struct {
+		item    string
+		queue   string
+		payload string
+		err     error
+	}{
+		{
+			`{"class":"MyClass","args":["hi",12345678901234567890],"queue":"high"}`,
+			"high",
+			`{"class":"MyClass","args":["hi",12345678901234567890]}`,
+			nil,
+		},
+		{
+			`{"class":"MyClass","queue":"high"}`,
+			"high",
+			`{"class":"MyClass","args":[]}`,
+			nil,
+		},
+		{
+			`{"class":"MyClass","args":[]}`,
+			"",
+			"",
+			errorInvalidDelayedItem,
+		},
+	} {
+		queue, payload, err := decodeDelayedItem([]byte(tt.item))
+		if err != tt.err {
+			t.Errorf("%s: expected error %v, actual %v", tt.item, tt.err, err)
+			continue
+		}
+		if queue != tt.queue || string(payload) != tt.payload {
+			t.Errorf("%s: expected %s %s, actual %s %s", tt.item, tt.queue, tt.payload, queue, payload)
+		}
+	}
+}
+
+func TestDelayedItemRoundTrip(t *testing.T) {
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass", Args: []interface{}{"hi"}}}
+	item, err := encodeDelayedItem(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, payload, err := decodeDelayedItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue != "high" || string(payload) != `{"class":"MyClass","args":["hi"]}` {
+		t.Errorf("expected high {\"class\":\"MyClass\",\"args\":[\"hi\"]}, actual %s %s", queue, payload)
+	}
+}
+
+func TestClientEnqueueDelayed(t *testing.T) {
+	client := dockerClient(WorkerSettings{QueuesString: "high"}, t)
+	defer dockerComposeStop(t)
+	defer client.Close()
+
+	now := time.Now()
+	due := &Job{Queue: "high", Payload: Payload{Class: "MyClass", Args: []interface{}{"due"}}}
+	later := &Job{Queue: "high", Payload: Payload{Class: "MyClass", Args: []interface{}{"later"}}}
+	if err := client.EnqueueAt(now.Add(-time.Minute), due); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.EnqueueAt(now.Add(time.Hour), later); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.PutConn(conn)
+
+	enqueued, err := client.enqueueDelayed(conn, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enqueued != 1 {
+		t.Errorf("expected 1 job to be enqueued, actual %d", enqueued)
+	}
+
+	queue, err := redis.Strings(conn.Do("LRANGE", client.queueKey("high"), 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{`{"class":"MyClass","args":["due"]}`}; !reflect.DeepEqual(queue, expected) {
+		t.Errorf("expected queue %v, actual %v", expected, queue)
+	}
+	if queues, _ := redis.Strings(conn.Do("SMEMBERS", client.queuesKey())); !reflect.DeepEqual(queues, []string{"high"}) {
+		t.Errorf("expected the queue to be registered, actual %v", queues)
+	}
+
+	schedule, err := redis.Strings(conn.Do("ZRANGE", fmt.Sprintf("%sdelayed_queue_schedule", client.Namespace()), 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{fmt.Sprint(now.Add(time.Hour).Unix())}; !reflect.DeepEqual(schedule, expected) {
+		t.Errorf("expected schedule %v, actual %v", expected, schedule)
+	}
+	item, err := encodeDelayedItem(due)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := redis.Bool(conn.Do("EXISTS", fmt.Sprintf("%stimestamps:%s", client.Namespace(), item))); exists {
+		t.Error("expected the timestamps of the enqueued job to be removed")
+	}
+}
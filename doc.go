@@ -69,6 +69,116 @@
 //		}
 //	}
 //
+// Worker functions which need to stop early, e.g. on
+// shutdown, can be registered with RegisterContext instead.
+// They receive the whole job and a context which is
+// cancelled when the job is abandoned:
+//
+//	func myHandler(ctx context.Context, job *goworker.Job) error {
+//		req, err := http.NewRequest("GET", "http://www.example.com/", nil)
+//		if err != nil {
+//			return err
+//		}
+//		_, err = http.DefaultClient.Do(req.WithContext(ctx))
+//		return err
+//	}
+//
+//	func init() {
+//		goworker.RegisterContext("MyClass", myHandler)
+//	}
+//
+// Middleware added with Use runs around every job, and
+// middleware added with UseClass around the jobs of a
+// class:
+//
+//	goworker.Use(func(next goworker.Handler) goworker.Handler {
+//		return func(ctx context.Context, job *goworker.Job) error {
+//			start := time.Now()
+//			err := next(ctx, job)
+//			log.Printf("%s took %v", job.Payload.Class, time.Since(start))
+//			return err
+//		}
+//	})
+//
+// The Resque job and worker hooks are added with AddHooks,
+// AddClassHooks and AddWorkerHooks. A BeforePerform hook
+// returning ErrDontPerform skips the job without failing it:
+//
+//	goworker.AddClassHooks("MyClass", goworker.Hooks{
+//		BeforePerform: func(ctx context.Context, job *goworker.Job) error {
+//			if maintenance() {
+//				return goworker.ErrDontPerform
+//			}
+//			return nil
+//		},
+//	})
+//
+// Failed jobs of a class can be retried with a backoff
+// which is compatible with resque-retry:
+//
+//	goworker.SetRetryPolicy("MyClass", goworker.RetryPolicy{
+//		MaxAttempts: 5,
+//		Backoff:     goworker.JitteredBackoff(time.Second, time.Hour),
+//		RetryOn:     []error{errorUnavailable},
+//	})
+//
+// The retries are scheduled in the delayed queue of
+// resque-scheduler. Only the last failure, after all
+// retries are used up, is recorded in the failed list.
+//
+// Jobs can be scheduled for later in the delayed queue of
+// resque-scheduler with EnqueueAt and EnqueueIn:
+//
+//	goworker.EnqueueIn(10*time.Minute, &goworker.Job{
+//		Queue:   "myqueue",
+//		Payload: goworker.Payload{Class: "MyClass", Args: []interface{}{"hi"}},
+//	})
+//
+// Run goworker with the -scheduler flag, or a Ruby
+// resque-scheduler, to enqueue them when they are due.
+//
+// Recurring jobs are added with AddSchedule before calling
+// Work:
+//
+//	goworker.AddSchedule(goworker.Schedule{
+//		Name:  "nightly-report",
+//		Cron:  "0 3 * * *",
+//		Class: "Report",
+//		Queue: "reports",
+//	})
+//
+// Processes may add the same or different schedules; for
+// every schedule, a single leader elected through Redis
+// among the processes which have it enqueues its jobs.
+//
+// Queues, QueueStats and Peek inspect the queues, while
+// Dequeue and MoveJobs remove jobs of a class from a queue
+// or move them onto another queue. PauseQueue stops all
+// processes from fetching the jobs of a queue until
+// UnpauseQueue is called.
+//
+// Failed jobs are kept in the failed list in the format of
+// resque-web. Failures reads them, and RetryFailures,
+// RemoveFailures and ClearFailures manage them:
+//
+//	retried, err := goworker.RetryFailures(goworker.FailureFilter{
+//		Class: "MyClass",
+//		Error: "connection refused",
+//	})
+//
+// Jobs run in OpenTelemetry spans. Jobs enqueued with
+// EnqueueContext carry the W3C trace context of ctx in their
+// payload, so that their spans continue the trace of the
+// code which enqueued them:
+//
+//	err := goworker.EnqueueContext(ctx, &goworker.Job{
+//		Queue:   "myqueue",
+//		Payload: goworker.Payload{Class: "MyClass", Args: []interface{}{"hi"}},
+//	})
+//
+// Jobs in the delayed queue of resque-scheduler, including
+// retries, keep its format and start new traces.
+//
 // goworker worker functions receive the queue they are
 // serving and a slice of interfaces. To use them as
 // parameters to other functions, use Go type assertions
@@ -100,6 +210,35 @@
 //		return nil
 //	}
 //
+// The package-level functions use a default client which
+// is configured by the command line flags. To consume
+// several Redis databases or namespaces from one program,
+// create a client for each of them:
+//
+//	client := goworker.NewClient(goworker.WorkerSettings{
+//		URI:               "redis://localhost:6379/",
+//		Namespace:         "resque:",
+//		QueuesString:      "myqueue",
+//		IntervalFloat:     5.0,
+//		Concurrency:       25,
+//		Connections:       2,
+//		ConnectionRetries: 5,
+//		Timeout:           3 * time.Second,
+//		UseNumber:         true,
+//	})
+//	client.Register("MyClass", myFunc)
+//	if err := client.Work(); err != nil {
+//		fmt.Println("Error:", err)
+//	}
+//
+// A client logs to standard output through seelog at the
+// info level unless WorkerSettings has a Logger. Messages
+// come with structured fields, such as the worker, queue,
+// class and duration of a job, so that they can be shipped
+// as JSON with log/slog:
+//
+//	settings.Logger = goworker.SlogLogger(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+//
 // For testing, it is helpful to use the redis-cli program
 // to insert jobs onto the Redis queue:
 //
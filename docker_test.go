@@ -6,6 +6,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/cihub/seelog"
 )
 
 type container struct {
@@ -204,6 +206,27 @@ func dockerClearDb(setup containerSetup, t *testing.T) {
 	}
 }
 
+// dockerClient starts the containers, clears Redis and
+// returns an initialized client of the master with the
+// given settings.
+func dockerClient(settings WorkerSettings, t *testing.T) *Client {
+	dockerComposeUp(t)
+	setup := scanSetup(t)
+	ensureMaster(setup, t)
+	dockerClearDb(setup, t)
+
+	settings.URI = fmt.Sprintf("redis://:%s@%s:6379/", Password, setup["master"][0].address)
+	settings.UseNumber = true
+	if settings.Logger == nil {
+		settings.Logger = SeelogLogger(seelog.Disabled)
+	}
+	client := NewClient(settings)
+	if err := client.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
 func dockerComposeStop(t *testing.T) {
 	func() {
 		t.Log("Stopping containers")
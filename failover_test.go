@@ -3,7 +3,7 @@ package goworker
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/garyburd/redigo/redis"
+	"github.com/gomodule/redigo/redis"
 	"reflect"
 	"strings"
 	"testing"
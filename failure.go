@@ -1,6 +1,11 @@
 package goworker
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
 	"time"
 )
 
@@ -13,3 +18,122 @@ type failure struct {
 	Worker    *worker   `json:"worker"`
 	Queue     string    `json:"queue"`
 }
+
+// PanicError is recorded as the failure of a job whose
+// handler panicked. Stack holds the stack of the panicking
+// goroutine in the backtrace format of resque-web.
+type PanicError struct {
+	Value interface{}
+	Stack []string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprint(e.Value)
+}
+
+// Unwrap exposes a panic value which is an error, e.g. a
+// runtime error, to errors.Is and errors.As.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// newPanicError captures the stack of the panicking
+// goroutine. It must be called by the deferred function
+// that recovered the panic.
+func newPanicError(value interface{}) *PanicError {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+
+	var stack []string
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			// drop the frames of the recovery
+			stack = stack[:0]
+		} else {
+			stack = append(stack, backtraceLine(frame.Function, frame.File, frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return &PanicError{Value: value, Stack: stack}
+}
+
+func backtraceLine(function, file string, line int) string {
+	return fmt.Sprintf("%s:%d:in `%s'", file, line, function)
+}
+
+// exception names the failure by the type of the error, or
+// of the panic value, as resque names it by the class of the
+// exception.
+func exception(err error) string {
+	switch err := err.(type) {
+	case *TimeoutError:
+		return "Timeout"
+	case *PanicError:
+		if err.Value == nil {
+			return "panic"
+		}
+		return typeName(err.Value)
+	}
+	return typeName(err)
+}
+
+func typeName(value interface{}) string {
+	return strings.TrimPrefix(reflect.TypeOf(value).String(), "*")
+}
+
+// backtrace returns the stack carried by err or by any error
+// it wraps. Besides panics, errors with a StackTrace method
+// returning formattable frames are supported, such as those
+// of github.com/pkg/errors.
+func backtrace(err error) []string {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if err, ok := err.(*PanicError); ok {
+			return err.Stack
+		}
+		if stack := stackTrace(err); stack != nil {
+			return stack
+		}
+	}
+	return nil
+}
+
+// stackTrace calls the StackTrace method of err through
+// reflection so that no error package has to be imported.
+// Every frame formatted with %+v reads as the function, a
+// newline and a tab, and the file and line.
+func stackTrace(err error) []string {
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return nil
+	}
+	frames := method.Call(nil)[0]
+	if frames.Kind() != reflect.Slice {
+		return nil
+	}
+
+	stack := make([]string, 0, frames.Len())
+	for i := 0; i < frames.Len(); i++ {
+		frame, ok := frames.Index(i).Interface().(fmt.Formatter)
+		if !ok {
+			return nil
+		}
+		parts := strings.SplitN(fmt.Sprintf("%+v", frame), "\n\t", 2)
+		if len(parts) != 2 {
+			stack = append(stack, parts[0])
+			continue
+		}
+		location := parts[1]
+		line := 0
+		if i := strings.LastIndex(location, ":"); i >= 0 {
+			fmt.Sscan(location[i+1:], &line)
+			location = location[:i]
+		}
+		stack = append(stack, backtraceLine(parts[0], location, line))
+	}
+	return stack
+}
@@ -0,0 +1,86 @@
+package goworker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+type testFrame string
+
+func (f testFrame) Format(s fmt.State, verb rune) {
+	fmt.Fprintf(s, "main.handler\n\t/src/%s.go:42", string(f))
+}
+
+type testStackError struct{}
+
+func (testStackError) Error() string { return "with stack" }
+
+func (testStackError) StackTrace() []testFrame { return []testFrame{"a", "b"} }
+
+type testCodeError struct{ code int }
+
+func (e *testCodeError) Error() string { return fmt.Sprint("code ", e.code) }
+
+var exceptionTests = []struct {
+	err      error
+	expected string
+}{
+	{errors.New("failed"), "errors.errorString"},
+	{&testCodeError{1}, "goworker.testCodeError"},
+	{&TimeoutError{}, "Timeout"},
+	{&PanicError{Value: "boom"}, "string"},
+	{&PanicError{Value: &testCodeError{1}}, "goworker.testCodeError"},
+}
+
+func TestException(t *testing.T) {
+	for _, tt := range exceptionTests {
+		actual := exception(tt.err)
+		if actual != tt.expected {
+			t.Errorf("exception(%#v): expected %s, actual %s", tt.err, tt.expected, actual)
+		}
+	}
+}
+
+func TestBacktraceStackTrace(t *testing.T) {
+	expected := []string{"/src/a.go:42:in `main.handler'", "/src/b.go:42:in `main.handler'"}
+	for _, err := range []error{testStackError{}, fmt.Errorf("wrapped: %w", testStackError{})} {
+		actual := backtrace(err)
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Errorf("backtrace(%v): expected %v, actual %v", err, expected, actual)
+		}
+	}
+	if actual := backtrace(errors.New("failed")); actual != nil {
+		t.Errorf("backtrace without stack: expected nil, actual %v", actual)
+	}
+}
+
+func panickingHandler(ctx context.Context, job *Job) error {
+	var m map[string]int
+	m["boom"]++
+	return nil
+}
+
+func TestWorkerCallPanicBacktrace(t *testing.T) {
+	w := newTestWorker()
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+
+	err := w.call(context.Background(), job, panickingHandler)
+	panicErr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("expected *PanicError, actual %#v", err)
+	}
+	stack := strings.Join(backtrace(err), "\n")
+	if !strings.Contains(stack, "goworker.panickingHandler'") {
+		t.Errorf("expected the backtrace to contain the handler, actual %v", stack)
+	}
+	if strings.Contains(stack, "runtime.gopanic") || strings.Contains(stack, "newPanicError") {
+		t.Errorf("expected the backtrace to omit the recovery, actual %v", stack)
+	}
+	if name := exception(err); !strings.HasPrefix(name, "runtime.") {
+		t.Errorf("expected a runtime exception, actual %s (%#v)", name, panicErr.Value)
+	}
+}
@@ -0,0 +1,426 @@
+package goworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// failuresPageSize is how many failures are fetched at
+	// once while scanning the failed list.
+	failuresPageSize = 100
+	// retriedAtLayout formats retried_at as resque does.
+	retriedAtLayout = "2006/01/02 15:04:05"
+)
+
+var (
+	errorFailureMissing = errors.New("failure no longer in the failed list")
+	errorFailurePayload = errors.New("failure without a payload")
+)
+
+// failedAtLayouts parse failed_at as written by goworker and
+// by resque.
+var failedAtLayouts = []string{
+	time.RFC3339Nano,
+	"2006/01/02 15:04:05 MST",
+	"2006/01/02 15:04:05 -0700",
+	retriedAtLayout,
+}
+
+// Failure is a failed job read from the failed list.
+type Failure struct {
+	// Index is the position of the failure in the failed list
+	// when it was read. Failures may move as others are
+	// removed, so Index is only a hint for RetryFailure.
+	Index     int
+	FailedAt  time.Time
+	RetriedAt time.Time
+	Payload   Payload
+	Exception string
+	Error     string
+	Backtrace []string
+	Worker    string
+	Queue     string
+
+	// raw identifies the failure in the failed list.
+	raw []byte
+}
+
+// Retried tells whether the failed job was already retried.
+func (f *Failure) Retried() bool {
+	return !f.RetriedAt.IsZero()
+}
+
+// FailureFilter selects failures. Empty fields match any
+// failure, Error matches any failure whose message contains
+// it.
+type FailureFilter struct {
+	Class     string
+	Queue     string
+	Exception string
+	Error     string
+}
+
+func (f FailureFilter) match(failure *Failure) bool {
+	return (f.Class == "" || f.Class == failure.Payload.Class) &&
+		(f.Queue == "" || f.Queue == failure.Queue) &&
+		(f.Exception == "" || f.Exception == failure.Exception) &&
+		(f.Error == "" || strings.Contains(failure.Error, f.Error))
+}
+
+// retryFailureScript marks a failure as retried and pushes
+// its payload back onto its queue. The failure is looked up
+// at its last known index first, and in the whole list when
+// it moved, so that concurrent workers appending failures
+// or clients removing them cannot make it retry another
+// failure.
+//
+// KEYS: failed list, queue, queues set. ARGV: index,
+// failure, retried failure, payload, queue name. Returns the
+// index of the failure, or -1 when it is gone.
+var retryFailureScript = redis.NewScript(3, `
+local index = tonumber(ARGV[1])
+if redis.call('LINDEX', KEYS[1], index) ~= ARGV[2] then
+	index = -1
+	local failures = redis.call('LRANGE', KEYS[1], 0, -1)
+	for i, failure in ipairs(failures) do
+		if failure == ARGV[2] then
+			index = i - 1
+			break
+		end
+	end
+	if index < 0 then
+		return -1
+	end
+end
+redis.call('LSET', KEYS[1], index, ARGV[3])
+redis.call('SADD', KEYS[3], ARGV[5])
+redis.call('RPUSH', KEYS[2], ARGV[4])
+return index
+`)
+
+// FailureCount returns the length of the failed list of the
+// default client.
+func FailureCount() (int, error) {
+	return defaultClient.FailureCount()
+}
+
+// Failures returns failures of the default client.
+func Failures(filter FailureFilter, offset, limit int) ([]*Failure, error) {
+	return defaultClient.Failures(filter, offset, limit)
+}
+
+// RetryFailure requeues a failed job of the default client.
+func RetryFailure(failure *Failure) error {
+	return defaultClient.RetryFailure(failure)
+}
+
+// RetryFailures requeues failed jobs of the default client.
+func RetryFailures(filter FailureFilter) (int, error) {
+	return defaultClient.RetryFailures(filter)
+}
+
+// RemoveFailure removes a failed job of the default client.
+func RemoveFailure(failure *Failure) error {
+	return defaultClient.RemoveFailure(failure)
+}
+
+// RemoveFailures removes failed jobs of the default client.
+func RemoveFailures(filter FailureFilter) (int, error) {
+	return defaultClient.RemoveFailures(filter)
+}
+
+// ClearFailures empties the failed list of the default
+// client.
+func ClearFailures() error {
+	return defaultClient.ClearFailures()
+}
+
+// FailureCount returns the length of the failed list.
+func (c *Client) FailureCount() (int, error) {
+	conn, err := c.initConn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.PutConn(conn)
+
+	return redis.Int(conn.Do("LLEN", c.failedKey()))
+}
+
+// Failures returns the failures selected by the filter,
+// oldest first, skipping the first offset of them. At most
+// limit failures are returned, or all of them when limit is
+// not positive.
+func (c *Client) Failures(filter FailureFilter, offset, limit int) ([]*Failure, error) {
+	conn, err := c.initConn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.PutConn(conn)
+
+	var failures []*Failure
+	err = c.scanFailures(conn, func(failure *Failure) bool {
+		if !filter.match(failure) {
+			return true
+		}
+		if offset > 0 {
+			offset--
+			return true
+		}
+		failures = append(failures, failure)
+		return limit <= 0 || len(failures) < limit
+	})
+	return failures, err
+}
+
+// RetryFailure pushes the failed job back onto its queue and
+// marks the failure as retried, as resque does. The failure
+// stays in the failed list until it is removed.
+func (c *Client) RetryFailure(failure *Failure) error {
+	conn, err := c.initConn()
+	if err != nil {
+		return err
+	}
+	defer c.PutConn(conn)
+
+	return c.retryFailure(conn, failure)
+}
+
+// RetryFailures retries every failure selected by the
+// filter and returns how many were retried. Failures
+// removed or retried concurrently are skipped.
+func (c *Client) RetryFailures(filter FailureFilter) (int, error) {
+	conn, err := c.initConn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.PutConn(conn)
+
+	failures, err := c.matchFailures(conn, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	retried := 0
+	for _, failure := range failures {
+		err := c.retryFailure(conn, failure)
+		if err == errorFailureMissing {
+			continue
+		}
+		if err != nil {
+			return retried, err
+		}
+		retried++
+	}
+	return retried, nil
+}
+
+// RemoveFailure removes the failure from the failed list.
+func (c *Client) RemoveFailure(failure *Failure) error {
+	conn, err := c.initConn()
+	if err != nil {
+		return err
+	}
+	defer c.PutConn(conn)
+
+	removed, err := redis.Int(conn.Do("LREM", c.failedKey(), 1, failure.raw))
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return errorFailureMissing
+	}
+	return nil
+}
+
+// RemoveFailures removes every failure selected by the
+// filter and returns how many were removed.
+func (c *Client) RemoveFailures(filter FailureFilter) (int, error) {
+	conn, err := c.initConn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.PutConn(conn)
+
+	failures, err := c.matchFailures(conn, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(failures) == 0 {
+		return 0, nil
+	}
+	for _, failure := range failures {
+		conn.Send("LREM", c.failedKey(), 1, failure.raw)
+	}
+	replies, err := redis.Ints(conn.Do(""))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, reply := range replies {
+		removed += reply
+	}
+	return removed, nil
+}
+
+// ClearFailures empties the failed list.
+func (c *Client) ClearFailures() error {
+	conn, err := c.initConn()
+	if err != nil {
+		return err
+	}
+	defer c.PutConn(conn)
+
+	_, err = conn.Do("DEL", c.failedKey())
+	return err
+}
+
+func (c *Client) failedKey() string {
+	return fmt.Sprintf("%sfailed", c.Namespace())
+}
+
+func (c *Client) retryFailure(conn *RedisConn, failure *Failure) error {
+	retriedAt := time.Now()
+	retried, payload, err := markRetried(failure.raw, retriedAt)
+	if err != nil {
+		return err
+	}
+
+	index, err := redis.Int(retryFailureScript.Do(
+		conn.Conn,
+		c.failedKey(),
+		c.queueKey(failure.Queue),
+		c.queuesKey(),
+		failure.Index,
+		failure.raw,
+		retried,
+		payload,
+		failure.Queue,
+	))
+	if err != nil {
+		return err
+	}
+	if index < 0 {
+		return errorFailureMissing
+	}
+
+	failure.Index = index
+	failure.RetriedAt = retriedAt
+	failure.raw = retried
+	return nil
+}
+
+// matchFailures returns all failures selected by the filter.
+func (c *Client) matchFailures(conn *RedisConn, filter FailureFilter) ([]*Failure, error) {
+	var failures []*Failure
+	err := c.scanFailures(conn, func(failure *Failure) bool {
+		if filter.match(failure) {
+			failures = append(failures, failure)
+		}
+		return true
+	})
+	return failures, err
+}
+
+// scanFailures calls f with every failure in the failed list
+// until f returns false. Failures which cannot be decoded
+// are skipped.
+func (c *Client) scanFailures(conn *RedisConn, f func(*Failure) bool) error {
+	for start := 0; ; start += failuresPageSize {
+		entries, err := redis.ByteSlices(conn.Do("LRANGE", c.failedKey(), start, start+failuresPageSize-1))
+		if err != nil {
+			return err
+		}
+		for i, entry := range entries {
+			failure, err := c.decodeFailure(entry)
+			if err != nil {
+				c.logger.Warn("Skipping failure which cannot be decoded", "index", start+i, "error", err)
+				continue
+			}
+			failure.Index = start + i
+			if !f(failure) {
+				return nil
+			}
+		}
+		if len(entries) < failuresPageSize {
+			return nil
+		}
+	}
+}
+
+func (c *Client) decodeFailure(raw []byte) (*Failure, error) {
+	var entry struct {
+		FailedAt  string          `json:"failed_at"`
+		RetriedAt string          `json:"retried_at"`
+		Payload   json.RawMessage `json:"payload"`
+		Exception string          `json:"exception"`
+		Error     string          `json:"error"`
+		Backtrace []string        `json:"backtrace"`
+		Worker    string          `json:"worker"`
+		Queue     string          `json:"queue"`
+	}
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, err
+	}
+
+	failure := &Failure{
+		FailedAt:  parseFailureTime(entry.FailedAt),
+		RetriedAt: parseFailureTime(entry.RetriedAt),
+		Exception: entry.Exception,
+		Error:     entry.Error,
+		Backtrace: entry.Backtrace,
+		Worker:    entry.Worker,
+		Queue:     entry.Queue,
+		raw:       raw,
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(entry.Payload))
+	if c.settings.UseNumber {
+		decoder.UseNumber()
+	}
+	if err := decoder.Decode(&failure.Payload); err != nil {
+		return nil, err
+	}
+	return failure, nil
+}
+
+func parseFailureTime(value string) time.Time {
+	for _, layout := range failedAtLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// markRetried sets retried_at of the raw failure, keeping
+// every other field as it is, and returns the failure along
+// with the payload to requeue.
+func markRetried(raw []byte, retriedAt time.Time) (failure, payload []byte, err error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, nil, err
+	}
+
+	if _, ok := fields["payload"]; !ok {
+		return nil, nil, errorFailurePayload
+	}
+
+	fields["retried_at"], err = json.Marshal(retriedAt.Format(retriedAtLayout))
+	if err != nil {
+		return nil, nil, err
+	}
+	failure, err = json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return failure, fields["payload"], nil
+}
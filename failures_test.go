@@ -0,0 +1,175 @@
+package goworker
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var decodeFailureTests = []struct {
+	raw      string
+	expected Failure
+}{
+	{
+		// written by goworker
+		`{"failed_at":"2017-03-25T10:20:30Z","payload":{"class":"MyClass","args":["hi",1]},"exception":"errors.errorString","error":"failed","backtrace":null,"worker":"host:1-0:high","queue":"high"}`,
+		Failure{
+			FailedAt:  time.Date(2017, 3, 25, 10, 20, 30, 0, time.UTC),
+			Payload:   Payload{Class: "MyClass", Args: []interface{}{"hi", json.Number("1")}},
+			Exception: "errors.errorString",
+			Error:     "failed",
+			Worker:    "host:1-0:high",
+			Queue:     "high",
+		},
+	},
+	{
+		// written by resque and retried
+		`{"failed_at":"2017/03/25 10:20:30 UTC","payload":{"class":"MyClass","args":[]},"exception":"RuntimeError","error":"failed","backtrace":["a.rb:1"],"worker":"host:2:low","queue":"low","retried_at":"2017/03/26 08:00:00"}`,
+		Failure{
+			FailedAt:  time.Date(2017, 3, 25, 10, 20, 30, 0, time.UTC),
+			RetriedAt: time.Date(2017, 3, 26, 8, 0, 0, 0, time.UTC),
+			Payload:   Payload{Class: "MyClass", Args: []interface{}{}},
+			Exception: "RuntimeError",
+			Error:     "failed",
+			Backtrace: []string{"a.rb:1"},
+			Worker:    "host:2:low",
+			Queue:     "low",
+		},
+	},
+}
+
+func TestDecodeFailure(t *testing.T) {
+	client := NewClient(WorkerSettings{UseNumber: true})
+	for _, tt := range decodeFailureTests {
+		actual, err := client.decodeFailure([]byte(tt.raw))
+		if err != nil {
+			t.Errorf("decodeFailure(%s): error %v", tt.raw, err)
+			continue
+		}
+		if string(actual.raw) != tt.raw {
+			t.Errorf("decodeFailure(%s): raw not kept", tt.raw)
+		}
+		actual.raw = nil
+		if !actual.FailedAt.Equal(tt.expected.FailedAt) || !actual.RetriedAt.Equal(tt.expected.RetriedAt) {
+			t.Errorf("decodeFailure(%s): expected times %v %v, actual %v %v", tt.raw, tt.expected.FailedAt, tt.expected.RetriedAt, actual.FailedAt, actual.RetriedAt)
+		}
+		actual.FailedAt, actual.RetriedAt = tt.expected.FailedAt, tt.expected.RetriedAt
+		if !reflect.DeepEqual(*actual, tt.expected) {
+			t.Errorf("decodeFailure(%s): expected %#v, actual %#v", tt.raw, tt.expected, *actual)
+		}
+		if actual.Retried() != !tt.expected.RetriedAt.IsZero() {
+			t.Errorf("decodeFailure(%s): Retried returned %v", tt.raw, actual.Retried())
+		}
+	}
+}
+
+var failureFilterTests = []struct {
+	filter   FailureFilter
+	expected bool
+}{
+	{FailureFilter{}, true},
+	{FailureFilter{Class: "MyClass", Queue: "high"}, true},
+	{FailureFilter{Class: "Other"}, false},
+	{FailureFilter{Queue: "low"}, false},
+	{FailureFilter{Exception: "Timeout"}, true},
+	{FailureFilter{Error: "timed out"}, true},
+	{FailureFilter{Error: "refused"}, false},
+}
+
+func TestFailureFilterMatch(t *testing.T) {
+	failure := &Failure{
+		Payload:   Payload{Class: "MyClass"},
+		Queue:     "high",
+		Exception: "Timeout",
+		Error:     "job MyClass on high timed out after 1s",
+	}
+	for _, tt := range failureFilterTests {
+		if actual := tt.filter.match(failure); actual != tt.expected {
+			t.Errorf("FailureFilter(%+v): expected %v, actual %v", tt.filter, tt.expected, actual)
+		}
+	}
+}
+
+func TestMarkRetried(t *testing.T) {
+	raw := []byte(`{"payload":{"class":"MyClass","args":[12345678901234567890]},"queue":"high","extra":{"kept":true}}`)
+	retriedAt := time.Date(2017, 3, 26, 8, 0, 0, 0, time.UTC)
+
+	failure, payload, err := markRetried(raw, retriedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"class":"MyClass","args":[12345678901234567890]}`; string(payload) != expected {
+		t.Errorf("expected payload %s, actual %s", expected, payload)
+	}
+	expected := `{"extra":{"kept":true},"payload":{"class":"MyClass","args":[12345678901234567890]},"queue":"high","retried_at":"2017/03/26 08:00:00"}`
+	if string(failure) != expected {
+		t.Errorf("expected failure %s, actual %s", expected, failure)
+	}
+
+	if _, _, err := markRetried([]byte(`{"queue":"high"}`), retriedAt); err != errorFailurePayload {
+		t.Errorf("expected %v without payload, actual %v", errorFailurePayload, err)
+	}
+}
+
+func TestClientRetryAndRemoveFailures(t *testing.T) {
+	client := dockerClient(WorkerSettings{QueuesString: "high"}, t)
+	defer dockerComposeStop(t)
+	defer client.Close()
+
+	conn, err := client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.PutConn(conn)
+
+	raws := []interface{}{client.failedKey()}
+	for _, tt := range decodeFailureTests {
+		raws = append(raws, tt.raw)
+	}
+	if _, err := conn.Do("RPUSH", raws...); err != nil {
+		t.Fatal(err)
+	}
+
+	failures, err := client.Failures(FailureFilter{Queue: "high"}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Retried() {
+		t.Fatalf("expected the failure of the high queue, actual %#v", failures)
+	}
+	if err := client.RetryFailure(failures[0]); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := redis.Strings(conn.Do("LRANGE", client.queueKey("high"), 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{`{"class":"MyClass","args":["hi",1]}`}; !reflect.DeepEqual(queue, expected) {
+		t.Errorf("expected the job to be retried on %v, actual %v", expected, queue)
+	}
+
+	failures, err = client.Failures(FailureFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 2 || !failures[0].Retried() {
+		t.Fatalf("expected the retried failure to stay in the failed list, actual %#v", failures)
+	}
+
+	if err := client.RemoveFailure(failures[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveFailure(failures[0]); err != errorFailureMissing {
+		t.Errorf("expected removing twice to fail with %v, actual %v", errorFailureMissing, err)
+	}
+	removed, err := client.RemoveFailures(FailureFilter{Exception: "RuntimeError"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := client.FailureCount(); removed != 1 || count != 0 {
+		t.Errorf("expected the last failure to be removed, actual %d removed and %d left", removed, count)
+	}
+}
@@ -1,31 +1,22 @@
 package goworker
 
 import (
-	"os"
-	"strconv"
-	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/context"
-
-	"errors"
-	"github.com/cihub/seelog"
-	"net"
-)
-
-var (
-	logger      seelog.LoggerInterface
-	sentinel    *Sentinel
-	ctx         context.Context
-	initMutex   sync.Mutex
-	initialized bool
 )
 
 var workerSettings WorkerSettings
 
+// defaultClient serves the package-level functions. It
+// shares workerSettings with the command line flags.
+var defaultClient = newClient(&workerSettings, true)
+
 type WorkerSettings struct {
 	QueuesString      string
 	Queues            queuesFlag
+	DynamicQueues     bool
 	IntervalFloat     float64
 	Interval          intervalFlag
 	Concurrency       int
@@ -35,10 +26,34 @@ type WorkerSettings struct {
 	ExitOnComplete    bool
 	IsStrict          bool
 	UseNumber         bool
+	Reliable          bool
+	Blocking          bool
 	Timeout           time.Duration
 	ConnectionRetries int
+	ShutdownTimeout   time.Duration
+	ShutdownRequeue   bool
+	JobTimeout        time.Duration
+	ClassTimeouts     timeoutsFlag
+	QueueTimeouts     timeoutsFlag
+	Scheduler         bool
+	SchedulerInterval time.Duration
+	CronCatchUp       CatchUpPolicy
+	MetricsAddr       string
+	TracerProvider    trace.TracerProvider
+	TraceRedis        bool
+	Logger            Logger
+	TLSCAFile         string
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSServerName     string
+	TLSSkipVerify     bool
+	RedisUsername     string
+	RedisPassword     string
+	SentinelUsername  string
+	SentinelPassword  string
 }
 
+// SetSettings replaces the settings of the default client.
 func SetSettings(settings WorkerSettings) {
 	workerSettings = settings
 }
@@ -48,45 +63,7 @@ func SetSettings(settings WorkerSettings) {
 // that wish to access goworker functions and configuration
 // without actually processing jobs.
 func Init() error {
-	initMutex.Lock()
-	defer initMutex.Unlock()
-	if !initialized {
-		var err error
-		logger, err = seelog.LoggerFromWriterWithMinLevel(os.Stdout, seelog.InfoLvl)
-		if err != nil {
-			return err
-		}
-
-		if err := flags(); err != nil {
-			return err
-		}
-		ctx = context.Background()
-
-		sentinel, err = NewSentinel(
-			workerSettings.URI,
-			workerSettings.Connections,
-			workerSettings.Connections,
-			workerSettings.Timeout,
-		)
-		if err != nil {
-			return err
-		}
-		go func() {
-			for {
-				if err := sentinel.Discover(); err != nil {
-					logger.Errorf("Sentinel discovery failed with %v", err)
-				}
-				time.Sleep(time.Minute)
-			}
-		}()
-
-		if err != nil {
-			return err
-		}
-
-		initialized = true
-	}
-	return nil
+	return defaultClient.Init()
 }
 
 // GetConn returns a connection from the goworker Redis
@@ -103,51 +80,7 @@ func Init() error {
 // several times and only if no attempt succeeds, it
 // returns the error.
 func GetConn() (*RedisConn, error) {
-	deadConnection := errors.New("Dead connection")
-	slaveConnection := errors.New("Stale connection (to slave, not master)")
-	try := func() (*RedisConn, error) {
-		conn, err := sentinel.GetConn(ctx)
-		if err != nil {
-			return nil, err
-		}
-
-		// close the connection and remove it from the pool so that new
-		// connections get created
-
-		// if the instance does not ping back
-		_, err = conn.Do("ping")
-		if err != nil {
-			conn.Close()
-			PutConn(nil)
-			return nil, deadConnection
-		}
-
-		// or if the instance is not a master anymore
-		role, err := role(conn.Do("role"))
-		if err != nil {
-			return nil, err
-		}
-		if role != "master" {
-			conn.Close()
-			PutConn(nil)
-			return nil, slaveConnection
-		}
-		return conn, nil
-	}
-
-	var conn *RedisConn
-	var err error
-	for i := 0; i < workerSettings.ConnectionRetries; i++ {
-		if conn, err = try(); err == nil {
-			return conn, nil
-		} else if err != slaveConnection && err != deadConnection {
-			if err, ok := err.(net.Error); ok && !err.Timeout() {
-				return nil, err
-			}
-		}
-	}
-
-	return conn, err
+	return defaultClient.GetConn()
 }
 
 // PutConn puts a connection back into the connection pool.
@@ -155,7 +88,7 @@ func GetConn() (*RedisConn, error) {
 // you got from GetConn. Expect this API to change
 // drastically.
 func PutConn(conn *RedisConn) {
-	sentinel.PutConn(conn)
+	defaultClient.PutConn(conn)
 }
 
 // Close cleans up resources initialized by goworker. This
@@ -170,12 +103,7 @@ func PutConn(conn *RedisConn) {
 //	}
 //	defer goworker.Close()
 func Close() {
-	initMutex.Lock()
-	defer initMutex.Unlock()
-	if initialized {
-		sentinel.Close()
-		initialized = false
-	}
+	defaultClient.Close()
 }
 
 // Work starts the goworker process. Check for errors in
@@ -184,31 +112,13 @@ func Close() {
 // received, or until the queues are empty if the
 // -exit-on-complete flag is set.
 func Work() error {
-	err := Init()
-	if err != nil {
-		return err
-	}
-	defer Close()
-
-	quit := signals()
-
-	poller, err := newPoller(workerSettings.Queues, workerSettings.IsStrict)
-	if err != nil {
-		return err
-	}
-	jobs := poller.poll(time.Duration(workerSettings.Interval), quit)
-
-	var monitor sync.WaitGroup
-
-	for id := 0; id < workerSettings.Concurrency; id++ {
-		worker, err := newWorker(strconv.Itoa(id), workerSettings.Queues)
-		if err != nil {
-			return err
-		}
-		worker.work(jobs, &monitor)
-	}
-
-	monitor.Wait()
+	return defaultClient.Work()
+}
 
-	return nil
+// WorkContext starts the goworker process like Work, and
+// additionally stops polling when ctx is done. Running jobs
+// get the -shutdown-timeout grace period to finish before
+// they are cancelled and Work returns an error.
+func WorkContext(ctx context.Context) error {
+	return defaultClient.WorkContext(ctx)
 }
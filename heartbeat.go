@@ -0,0 +1,267 @@
+package goworker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Like Resque 1.26 and newer, every process records the
+// time it was last seen alive in the hash
+//
+//	resque:workers:heartbeat
+//
+// and refreshes it every heartbeatInterval while Work runs.
+// When goworker starts, it prunes the workers whose
+// heartbeat is older than pruneAfter, so that killed
+// processes do not stay in resque:workers forever.
+const (
+	heartbeatInterval = time.Minute
+	pruneAfter        = 5 * heartbeatInterval
+)
+
+// heartbeatLayouts parse heartbeats written by goworker and
+// by the Resque versions using ISO 8601 or Time#to_s.
+var heartbeatLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+}
+
+var errorInvalidWorkerID = errors.New("invalid worker id")
+
+// pruneWorkerScript unregisters a dead worker, provided its
+// heartbeat and its job are still those the caller read, so
+// that processes starting at the same time cannot prune a
+// worker twice. The job of the worker is pushed onto a
+// queue or onto the failed list.
+//
+// KEYS: heartbeats hash, workers set, worker, worker
+// started, worker processed stat, worker failed stat, list
+// for the job, failed stat, worker paused. ARGV: worker id,
+// heartbeat, job, pushed value, requeue or fail.
+var pruneWorkerScript = redis.NewScript(9, `
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+if (redis.call('GET', KEYS[3]) or '') ~= ARGV[3] then
+	return 0
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('SREM', KEYS[2], ARGV[1])
+redis.call('DEL', KEYS[3], KEYS[4], KEYS[5], KEYS[6], KEYS[9])
+if ARGV[4] ~= '' then
+	if ARGV[5] == 'requeue' then
+		redis.call('LPUSH', KEYS[7], ARGV[4])
+	else
+		redis.call('RPUSH', KEYS[7], ARGV[4])
+		redis.call('INCR', KEYS[8])
+	end
+end
+return 1
+`)
+
+func (c *Client) heartbeatKey() string {
+	return fmt.Sprintf("%sworkers:heartbeat", c.Namespace())
+}
+
+// alive adds an opened process to the processes whose
+// heartbeat is refreshed.
+func (c *Client) alive(conn *RedisConn, p *process) error {
+	c.processesMutex.Lock()
+	defer c.processesMutex.Unlock()
+
+	c.processes[p.String()] = true
+	return conn.Send("HSET", c.heartbeatKey(), p, time.Now().Format(time.RFC3339))
+}
+
+// dead removes a closed process from the processes whose
+// heartbeat is refreshed. A heartbeat being sent for it
+// completes first, so the heartbeat is deleted for good.
+func (c *Client) dead(conn *RedisConn, p *process) error {
+	c.processesMutex.Lock()
+	delete(c.processes, p.String())
+	c.processesMutex.Unlock()
+
+	return conn.Send("HDEL", c.heartbeatKey(), p)
+}
+
+// beat refreshes the heartbeats of the open processes.
+func (c *Client) beat(conn *RedisConn) error {
+	c.processesMutex.Lock()
+	defer c.processesMutex.Unlock()
+
+	if len(c.processes) == 0 {
+		return nil
+	}
+	now := time.Now().Format(time.RFC3339)
+	args := []interface{}{c.heartbeatKey()}
+	for id := range c.processes {
+		args = append(args, id, now)
+	}
+	_, err := conn.Do("HSET", args...)
+	return err
+}
+
+// holdHeartbeat refreshes the heartbeats of the open
+// processes until the returned function is called.
+func (c *Client) holdHeartbeat() func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				conn, err := c.GetConn()
+				if err != nil {
+					c.logger.Error("Error on getting connection to send heartbeats", "error", err)
+					continue
+				}
+				if err := c.beat(conn); err != nil {
+					c.logger.Error("Error sending heartbeats", "error", err)
+				}
+				c.PutConn(conn)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// pruneDeadWorkers unregisters the workers whose heartbeat
+// expired. The job a dead worker was running is pushed back
+// to the head of its queue with ShutdownRequeue, and
+// recorded as failed otherwise, as Resque does. The job of
+// a worker that ran in reliable mode is left to the recovery
+// of in-flight lists, whatever the mode of the pruner.
+func (c *Client) pruneDeadWorkers(conn *RedisConn) error {
+	heartbeats, err := redis.StringMap(conn.Do("HGETALL", c.heartbeatKey()))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for id, heartbeat := range heartbeats {
+		seen, ok := parseHeartbeat(heartbeat)
+		if !ok {
+			c.logger.Warn("Skipping worker with invalid heartbeat", "worker", id, "heartbeat", heartbeat)
+			continue
+		}
+		if now.Sub(seen) <= pruneAfter {
+			continue
+		}
+		if err := c.pruneWorker(conn, id, heartbeat); err != nil {
+			c.logger.Error("Error pruning dead worker", "worker", id, "error", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) pruneWorker(conn *RedisConn, id, heartbeat string) error {
+	job, err := redis.Bytes(conn.Do("GET", fmt.Sprintf("%sworker:%s", c.Namespace(), id)))
+	if err != nil && err != redis.ErrNil {
+		return err
+	}
+
+	list, value, mode := "", []byte{}, ""
+	var running struct {
+		Queue    string          `json:"queue"`
+		Payload  json.RawMessage `json:"payload"`
+		Reliable bool            `json:"reliable"`
+	}
+	if len(job) > 0 {
+		if err := json.Unmarshal(job, &running); err != nil {
+			return err
+		}
+	}
+	if len(job) > 0 && !running.Reliable {
+		if c.settings.ShutdownRequeue {
+			list, value, mode = c.queueKey(running.Queue), running.Payload, "requeue"
+		} else {
+			var payload Payload
+			if err := c.decodePayload(running.Payload, &payload); err != nil {
+				return err
+			}
+			var dead *worker
+			if p, err := parseProcess(id); err == nil {
+				dead = &worker{process: *p}
+			}
+			failure := &failure{
+				FailedAt:  time.Now(),
+				Payload:   payload,
+				Exception: "DirtyExit",
+				Error:     fmt.Sprintf("worker %s stopped sending heartbeats", id),
+				Worker:    dead,
+				Queue:     running.Queue,
+			}
+			if value, err = json.Marshal(failure); err != nil {
+				return err
+			}
+			list, mode = c.failedKey(), "fail"
+		}
+	}
+
+	pruned, err := redis.Bool(pruneWorkerScript.Do(
+		conn.Conn,
+		c.heartbeatKey(),
+		fmt.Sprintf("%sworkers", c.Namespace()),
+		fmt.Sprintf("%sworker:%s", c.Namespace(), id),
+		fmt.Sprintf("%sworker:%s:started", c.Namespace(), id),
+		fmt.Sprintf("%sstat:processed:%s", c.Namespace(), id),
+		fmt.Sprintf("%sstat:failed:%s", c.Namespace(), id),
+		list,
+		fmt.Sprintf("%sstat:failed", c.Namespace()),
+		fmt.Sprintf("%sworker:%s:paused", c.Namespace(), id),
+		id,
+		heartbeat,
+		job,
+		value,
+		mode,
+	))
+	if err != nil {
+		return err
+	}
+	if pruned {
+		c.logger.Info("Pruned dead worker", "worker", id)
+	}
+	return nil
+}
+
+func parseHeartbeat(heartbeat string) (time.Time, bool) {
+	for _, layout := range heartbeatLayouts {
+		if t, err := time.Parse(layout, heartbeat); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseProcess parses the id of a goworker process,
+// hostname:pid-id:queues, or of a Resque worker,
+// hostname:pid:queues.
+func parseProcess(id string) (*process, error) {
+	parts := strings.SplitN(id, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, errorInvalidWorkerID
+	}
+	pidAndID := strings.SplitN(parts[1], "-", 2)
+	pid, err := strconv.Atoi(pidAndID[0])
+	if err != nil {
+		return nil, errorInvalidWorkerID
+	}
+	p := &process{
+		Hostname: parts[0],
+		Pid:      pid,
+		Queues:   strings.Split(parts[2], ","),
+	}
+	if len(pidAndID) == 2 {
+		p.ID = pidAndID[1]
+	}
+	return p, nil
+}
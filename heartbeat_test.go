@@ -0,0 +1,200 @@
+package goworker
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var parseProcessTests = []struct {
+	id       string
+	expected *process
+}{
+	{
+		"hostname:12345-123:high,low",
+		&process{Hostname: "hostname", Pid: 12345, ID: "123", Queues: []string{"high", "low"}},
+	},
+	{
+		"hostname:12345-poller:*",
+		&process{Hostname: "hostname", Pid: 12345, ID: "poller", Queues: []string{"*"}},
+	},
+	{
+		// Resque
+		"hostname:12345:high",
+		&process{Hostname: "hostname", Pid: 12345, Queues: []string{"high"}},
+	},
+	{"hostname:pid-1:high", nil},
+	{"hostname:12345", nil},
+	{":12345-1:high", nil},
+}
+
+func TestParseProcess(t *testing.T) {
+	for _, tt := range parseProcessTests {
+		actual, err := parseProcess(tt.id)
+		if tt.expected == nil {
+			if err != errorInvalidWorkerID {
+				t.Errorf("parseProcess(%q): expected error %v, actual %v", tt.id, errorInvalidWorkerID, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseProcess(%q): error %v", tt.id, err)
+			continue
+		}
+		if actual.String() != tt.expected.String() || actual.ID != tt.expected.ID {
+			t.Errorf("parseProcess(%q): expected %#v, actual %#v", tt.id, tt.expected, actual)
+		}
+	}
+}
+
+var parseHeartbeatTests = []struct {
+	heartbeat string
+	expected  time.Time
+	ok        bool
+}{
+	{"2017-03-25T10:20:30Z", time.Date(2017, 3, 25, 10, 20, 30, 0, time.UTC), true},
+	{"2017-03-25T11:20:30+01:00", time.Date(2017, 3, 25, 10, 20, 30, 0, time.UTC), true},
+	{"2017-03-25 11:20:30 +0100", time.Date(2017, 3, 25, 10, 20, 30, 0, time.UTC), true},
+	{"yesterday", time.Time{}, false},
+}
+
+func TestParseHeartbeat(t *testing.T) {
+	for _, tt := range parseHeartbeatTests {
+		actual, ok := parseHeartbeat(tt.heartbeat)
+		if ok != tt.ok || !actual.Equal(tt.expected) {
+			t.Errorf("parseHeartbeat(%q): expected %v %v, actual %v %v", tt.heartbeat, tt.expected, tt.ok, actual, ok)
+		}
+	}
+}
+
+func TestClientPruneDeadWorkers(t *testing.T) {
+	client := dockerClient(WorkerSettings{QueuesString: "high"}, t)
+	defer dockerComposeStop(t)
+	defer client.Close()
+
+	conn, err := client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.PutConn(conn)
+
+	now := time.Now()
+	job := `{"queue":"high","run_at":"2017-03-25T10:20:30Z","payload":{"class":"MyClass","args":[1]}}`
+	register := func(id string, seen time.Time, job string) {
+		conn.Send("SADD", fmt.Sprintf("%sworkers", client.Namespace()), id)
+		conn.Send("HSET", client.heartbeatKey(), id, seen.Format("2006-01-02 15:04:05 -0700"))
+		if job != "" {
+			conn.Send("SET", fmt.Sprintf("%sworker:%s", client.Namespace(), id), job)
+		}
+		if _, err := conn.Do(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	register("host:1-1:high", now, job)
+	register("host:2-1:high", now.Add(-time.Hour), job)
+	register("host:3:high", now.Add(-time.Hour), "")
+	if err := client.pruneDeadWorkers(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	client.settings.ShutdownRequeue = true
+	register("host:4-1:high", now.Add(-time.Hour), job)
+	if err := client.pruneDeadWorkers(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	workers, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%sworkers", client.Namespace())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	heartbeats, err := redis.StringMap(conn.Do("HGETALL", client.heartbeatKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(workers)
+	if _, ok := heartbeats["host:1-1:high"]; !reflect.DeepEqual(workers, []string{"host:1-1:high"}) || len(heartbeats) != 1 || !ok {
+		t.Errorf("expected only the live worker to stay, actual %v and heartbeats %v", workers, heartbeats)
+	}
+	if exists, _ := redis.Bool(conn.Do("EXISTS", fmt.Sprintf("%sworker:host:2-1:high", client.Namespace()))); exists {
+		t.Error("expected the job of the pruned worker to be removed")
+	}
+
+	failures, err := client.Failures(FailureFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Exception != "DirtyExit" || failures[0].Worker != "host:2-1:high" {
+		t.Errorf("expected the job of the dead worker to fail, actual %#v", failures)
+	}
+	queue, err := redis.Strings(conn.Do("LRANGE", client.queueKey("high"), 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{`{"class":"MyClass","args":[1]}`}; !reflect.DeepEqual(queue, expected) {
+		t.Errorf("expected the job of the requeueing worker on %v, actual %v", expected, queue)
+	}
+}
+
+func TestClientPruneDeadWorkersMixedModes(t *testing.T) {
+	client := dockerClient(WorkerSettings{QueuesString: "high", Reliable: true}, t)
+	defer dockerComposeStop(t)
+	defer client.Close()
+
+	conn, err := client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.PutConn(conn)
+
+	seen := time.Now().Add(-time.Hour).Format("2006-01-02 15:04:05 -0700")
+	register := func(id string, job string) {
+		conn.Send("SADD", fmt.Sprintf("%sworkers", client.Namespace()), id)
+		conn.Send("HSET", client.heartbeatKey(), id, seen)
+		conn.Send("SET", fmt.Sprintf("%sworker:%s", client.Namespace(), id), job)
+		if _, err := conn.Do(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a reliable pruner fails the job of a dead worker that was not reliable
+	register("host:1-1:high", `{"queue":"high","run_at":"2017-03-25T10:20:30Z","payload":{"class":"MyClass","args":[1]}}`)
+	if err := client.pruneDeadWorkers(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	// a pruner that is not reliable leaves the job of a dead reliable
+	// worker to the recovery of its in-flight list
+	client.settings.Reliable = false
+	client.settings.ShutdownRequeue = true
+	register("host:2-1:high", `{"queue":"high","run_at":"2017-03-25T10:20:30Z","payload":{"class":"MyClass","args":[2]},"reliable":true}`)
+	if err := client.pruneDeadWorkers(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	workers, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%sworkers", client.Namespace())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workers) != 0 {
+		t.Errorf("expected both dead workers to be pruned, actual %v", workers)
+	}
+	failures, err := client.Failures(FailureFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Worker != "host:1-1:high" {
+		t.Errorf("expected only the job of the worker that was not reliable to fail, actual %#v", failures)
+	}
+	queue, err := redis.Strings(conn.Do("LRANGE", client.queueKey("high"), 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 0 {
+		t.Errorf("expected the job of the reliable worker not to be requeued, actual %v", queue)
+	}
+}
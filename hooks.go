@@ -0,0 +1,200 @@
+package goworker
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+)
+
+// ErrDontPerform is returned by a BeforeEnqueue or a
+// BeforePerform hook to abort the job, like raising
+// Resque::Job::DontPerform. The job is then neither
+// enqueued, nor performed, nor recorded as failed.
+var ErrDontPerform = errors.New("job aborted by a hook")
+
+// Hooks are the Resque job hooks. Any of them may be nil.
+type Hooks struct {
+	// BeforeEnqueue runs in Enqueue before the job is pushed.
+	// An error other than ErrDontPerform is returned by
+	// Enqueue.
+	BeforeEnqueue func(job *Job) error
+	// AfterEnqueue runs in Enqueue after the job is pushed.
+	AfterEnqueue func(job *Job)
+	// BeforePerform runs before the job. An error other than
+	// ErrDontPerform fails the job.
+	BeforePerform func(ctx context.Context, job *Job) error
+	// AfterPerform runs after the job succeeded.
+	AfterPerform func(ctx context.Context, job *Job)
+	// OnFailure runs after the job failed, before the failure
+	// is recorded or the job retried.
+	OnFailure func(ctx context.Context, job *Job, err error)
+}
+
+// WorkerHooks are the Resque worker hooks. Any of them may
+// be nil.
+type WorkerHooks struct {
+	// BeforeFirstFork runs once in Work before polling starts.
+	BeforeFirstFork func()
+	// goworker runs jobs in goroutines instead of forked
+	// processes, so nothing separates the fork hooks: for
+	// every job, BeforeFork runs where Resque would fork,
+	// then AfterFork runs where the forked child would
+	// start, both before the perform hooks and in the same
+	// process. State set up by BeforeFork is thus seen by
+	// AfterFork and the job, and AfterFork cannot be used
+	// to reopen resources shared with a parent. A panic of
+	// either hook fails the job.
+	BeforeFork func(job *Job)
+	AfterFork  func(job *Job)
+	// Open and Close run when the poller or a worker is
+	// registered in and removed from resque:workers.
+	Open  func(worker string)
+	Close func(worker string)
+}
+
+// AddHooks adds hooks for every job of the default client.
+func AddHooks(hooks Hooks) {
+	defaultClient.AddHooks(hooks)
+}
+
+// AddClassHooks adds hooks for the jobs of a class of the
+// default client.
+func AddClassHooks(class string, hooks Hooks) {
+	defaultClient.AddClassHooks(class, hooks)
+}
+
+// AddWorkerHooks adds worker hooks to the default client.
+func AddWorkerHooks(hooks WorkerHooks) {
+	defaultClient.AddWorkerHooks(hooks)
+}
+
+// AddHooks adds hooks for every job. They run before the
+// hooks of the classes, in the order they were added.
+func (c *Client) AddHooks(hooks Hooks) {
+	c.hooks = append(c.hooks, hooks)
+}
+
+// AddClassHooks adds hooks for the jobs of a class.
+func (c *Client) AddClassHooks(class string, hooks Hooks) {
+	c.classHooks[class] = append(c.classHooks[class], hooks)
+}
+
+// AddWorkerHooks adds worker hooks.
+func (c *Client) AddWorkerHooks(hooks WorkerHooks) {
+	c.workerHooks = append(c.workerHooks, hooks)
+}
+
+// jobHooks returns the hooks of the class, the global ones
+// first.
+func (c *Client) jobHooks(class string) []Hooks {
+	return append(c.hooks[:len(c.hooks):len(c.hooks)], c.classHooks[class]...)
+}
+
+// beforeEnqueue runs the BeforeEnqueue hooks until one of
+// them returns an error.
+func (c *Client) beforeEnqueue(job *Job) error {
+	for _, hooks := range c.jobHooks(job.Payload.Class) {
+		if hooks.BeforeEnqueue != nil {
+			if err := hooks.BeforeEnqueue(job); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) afterEnqueue(job *Job) {
+	for _, hooks := range c.jobHooks(job.Payload.Class) {
+		if hooks.AfterEnqueue != nil {
+			hooks.AfterEnqueue(job)
+		}
+	}
+}
+
+// workerHook runs f with every worker hooks.
+func (c *Client) workerHook(f func(hooks WorkerHooks)) {
+	for _, hooks := range c.workerHooks {
+		f(hooks)
+	}
+}
+
+// forkHooks is the built-in middleware which runs the fork
+// hooks of the worker before the rest of the chain. Panics
+// of the hooks fail the job like panics of the job.
+func (w *worker) forkHooks(next Handler) Handler {
+	return func(ctx context.Context, job *Job) error {
+		for _, h := range w.client.workerHooks {
+			if h.BeforeFork == nil {
+				continue
+			}
+			if err := w.recoverPanics(func(ctx context.Context, job *Job) error {
+				h.BeforeFork(job)
+				return nil
+			})(ctx, job); err != nil {
+				return err
+			}
+		}
+		for _, h := range w.client.workerHooks {
+			if h.AfterFork == nil {
+				continue
+			}
+			if err := w.recoverPanics(func(ctx context.Context, job *Job) error {
+				h.AfterFork(job)
+				return nil
+			})(ctx, job); err != nil {
+				return err
+			}
+		}
+		return next(ctx, job)
+	}
+}
+
+// performHooks is the built-in middleware which runs the
+// perform hooks of the job around the rest of the chain.
+// Panics of the hooks fail the job like panics of the job.
+func (w *worker) performHooks(next Handler) Handler {
+	return func(ctx context.Context, job *Job) error {
+		hooks := w.client.jobHooks(job.Payload.Class)
+		if len(hooks) == 0 {
+			return next(ctx, job)
+		}
+
+		for _, h := range hooks {
+			if h.BeforePerform == nil {
+				continue
+			}
+			err := w.recoverPanics(func(ctx context.Context, job *Job) error {
+				return h.BeforePerform(ctx, job)
+			})(ctx, job)
+			if err == ErrDontPerform {
+				w.client.logger.Info("Not performing job aborted by a hook", w.jobFields(job)...)
+				trace.SpanFromContext(ctx).AddEvent("aborted by a hook")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		err := next(ctx, job)
+
+		for _, h := range hooks {
+			if err == nil && h.AfterPerform != nil {
+				if hookErr := w.recoverPanics(func(ctx context.Context, job *Job) error {
+					h.AfterPerform(ctx, job)
+					return nil
+				})(ctx, job); hookErr != nil {
+					return hookErr
+				}
+			}
+			if err != nil && h.OnFailure != nil {
+				w.recoverPanics(func(ctx context.Context, job *Job) error {
+					h.OnFailure(ctx, job, err)
+					return nil
+				})(ctx, job)
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,164 @@
+package goworker
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestWorkerPerformHooks(t *testing.T) {
+	failed := errors.New("failed")
+	refused := errors.New("refused")
+
+	for _, tt := range []struct {
+		before   error
+		job      error
+		expected error
+		calls    []string
+	}{
+		{nil, nil, nil, []string{"before global", "before class", "job", "after global", "after class"}},
+		{nil, failed, failed, []string{"before global", "before class", "job", "failure global failed", "failure class failed"}},
+		{ErrDontPerform, nil, nil, []string{"before global"}},
+		{refused, nil, refused, []string{"before global"}},
+	} {
+		var calls []string
+		w := newTestWorker()
+		w.client.AddHooks(Hooks{
+			BeforePerform: func(ctx context.Context, job *Job) error {
+				calls = append(calls, "before global")
+				return tt.before
+			},
+			AfterPerform: func(ctx context.Context, job *Job) {
+				calls = append(calls, "after global")
+			},
+			OnFailure: func(ctx context.Context, job *Job, err error) {
+				calls = append(calls, "failure global "+err.Error())
+			},
+		})
+		w.client.AddClassHooks("MyClass", Hooks{
+			BeforePerform: func(ctx context.Context, job *Job) error {
+				calls = append(calls, "before class")
+				return nil
+			},
+			AfterPerform: func(ctx context.Context, job *Job) {
+				calls = append(calls, "after class")
+			},
+			OnFailure: func(ctx context.Context, job *Job, err error) {
+				calls = append(calls, "failure class "+err.Error())
+			},
+		})
+		w.client.AddClassHooks("OtherClass", Hooks{
+			BeforePerform: func(ctx context.Context, job *Job) error {
+				calls = append(calls, "before other")
+				return nil
+			},
+		})
+
+		job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+		err := w.performHooks(func(ctx context.Context, job *Job) error {
+			calls = append(calls, "job")
+			return tt.job
+		})(context.Background(), job)
+
+		if err != tt.expected {
+			t.Errorf("before %v, job %v: expected error %v, actual %v", tt.before, tt.job, tt.expected, err)
+		}
+		if !reflect.DeepEqual(calls, tt.calls) {
+			t.Errorf("before %v, job %v: expected calls %v, actual %v", tt.before, tt.job, tt.calls, calls)
+		}
+	}
+}
+
+func TestWorkerPerformHooksPanic(t *testing.T) {
+	w := newTestWorker()
+	w.client.AddHooks(Hooks{
+		BeforePerform: func(ctx context.Context, job *Job) error {
+			panic("hook")
+		},
+	})
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+
+	err := w.performHooks(func(ctx context.Context, job *Job) error {
+		t.Error("expected the job not to run")
+		return nil
+	})(context.Background(), job)
+	if _, ok := err.(*PanicError); !ok {
+		t.Errorf("expected a PanicError, actual %#v", err)
+	}
+}
+
+func TestClientBeforeEnqueue(t *testing.T) {
+	client := NewClient(WorkerSettings{})
+	var calls []string
+	client.AddHooks(Hooks{
+		BeforeEnqueue: func(job *Job) error {
+			calls = append(calls, "global")
+			return ErrDontPerform
+		},
+	})
+	client.AddClassHooks("MyClass", Hooks{
+		BeforeEnqueue: func(job *Job) error {
+			calls = append(calls, "class")
+			return nil
+		},
+	})
+
+	err := client.beforeEnqueue(&Job{Queue: "high", Payload: Payload{Class: "MyClass"}})
+	if err != ErrDontPerform {
+		t.Errorf("expected %v, actual %v", ErrDontPerform, err)
+	}
+	if !reflect.DeepEqual(calls, []string{"global"}) {
+		t.Errorf("expected only the global hook to run, actual %v", calls)
+	}
+}
+
+func TestWorkerForkHooks(t *testing.T) {
+	var calls []string
+	w := newTestWorker()
+	w.client.AddWorkerHooks(WorkerHooks{
+		BeforeFork: func(job *Job) {
+			calls = append(calls, "before fork")
+		},
+		AfterFork: func(job *Job) {
+			calls = append(calls, "after fork")
+		},
+	})
+	w.client.AddWorkerHooks(WorkerHooks{
+		BeforeFork: func(job *Job) {
+			calls = append(calls, "before fork 2")
+		},
+	})
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+
+	err := w.forkHooks(func(ctx context.Context, job *Job) error {
+		calls = append(calls, "job")
+		return nil
+	})(context.Background(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"before fork", "before fork 2", "after fork", "job"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, actual %v", expected, calls)
+	}
+}
+
+func TestWorkerForkHooksPanic(t *testing.T) {
+	w := newTestWorker()
+	w.client.AddWorkerHooks(WorkerHooks{
+		AfterFork: func(job *Job) {
+			panic("hook")
+		},
+	})
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+
+	err := w.forkHooks(func(ctx context.Context, job *Job) error {
+		t.Error("expected the job not to run")
+		return nil
+	})(context.Background(), job)
+	if _, ok := err.(*PanicError); !ok {
+		t.Errorf("expected a PanicError, actual %#v", err)
+	}
+}
@@ -3,4 +3,11 @@ package goworker
 type Job struct {
 	Queue   string
 	Payload Payload
+
+	// raw holds the payload as fetched in reliable mode, to
+	// identify the job in the in-flight list.
+	raw []byte
+	// attempt counts the runs of a job with a retry policy,
+	// starting at 1. It is 0 when attempts are not counted.
+	attempt int
 }
@@ -0,0 +1,124 @@
+package goworker
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/cihub/seelog"
+)
+
+// Logger receives the log of a client. Every message comes
+// with fields which alternate keys and values, the same way
+// as the arguments of log/slog, e.g.
+//
+//	logger.Info("Requeueing job cancelled by shutdown", "worker", "host:1-0:high", "queue", "high", "class", "MyClass")
+//
+// The fields include the worker, queue, class and job id
+// where they apply, the error and the duration of jobs.
+// Use SlogLogger or SeelogLogger to log with either library.
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// SlogLogger returns a Logger writing to the slog logger, or
+// to the default slog logger when it is nil. A *slog.Logger
+// is a Logger itself.
+func SlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// SeelogLogger returns a Logger writing to the seelog
+// logger. The fields follow the message as key=value pairs.
+func SeelogLogger(logger seelog.LoggerInterface) Logger {
+	return seelogLogger{logger}
+}
+
+type seelogLogger struct {
+	logger seelog.LoggerInterface
+}
+
+func (l seelogLogger) Debug(msg string, fields ...interface{}) {
+	l.logger.Debug(formatFields(msg, fields))
+}
+
+func (l seelogLogger) Info(msg string, fields ...interface{}) {
+	l.logger.Info(formatFields(msg, fields))
+}
+
+func (l seelogLogger) Warn(msg string, fields ...interface{}) {
+	l.logger.Warn(formatFields(msg, fields))
+}
+
+func (l seelogLogger) Error(msg string, fields ...interface{}) {
+	l.logger.Error(formatFields(msg, fields))
+}
+
+// formatFields appends the fields to the message as
+// key=value pairs, quoting the values which need it. A value
+// without a key gets the key !BADKEY, as in log/slog.
+func formatFields(msg string, fields []interface{}) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		key, ok := fields[i].(string)
+		value := fields[i]
+		if ok && i+1 < len(fields) {
+			value = fields[i+1]
+		} else {
+			key = "!BADKEY"
+			i--
+		}
+
+		text := fmt.Sprint(value)
+		if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+			text = strconv.Quote(text)
+		}
+		fmt.Fprintf(&buffer, " %s=%s", key, text)
+	}
+	return buffer.String()
+}
+
+// jobFields returns the fields which identify the job in the
+// log, followed by the given ones.
+func jobFields(job *Job, fields ...interface{}) []interface{} {
+	jobFields := []interface{}{"queue", job.Queue, "class", job.Payload.Class}
+	if id := jobID(job); id != "" {
+		jobFields = append(jobFields, "job", id)
+	}
+	return append(jobFields, fields...)
+}
+
+// jobID returns the id of the job. Resque payloads have no
+// id, but ActiveJob passes its job_id in the first argument.
+func jobID(job *Job) string {
+	if len(job.Payload.Args) == 0 {
+		return ""
+	}
+	arg, ok := job.Payload.Args[0].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	id, _ := arg["job_id"].(string)
+	return id
+}
+
+// fields returns the fields which identify the process in
+// the log, followed by the given ones.
+func (p *process) fields(fields ...interface{}) []interface{} {
+	return append([]interface{}{"worker", p.String()}, fields...)
+}
+
+// jobFields returns the fields which identify the process
+// and its job in the log, followed by the given ones.
+func (p *process) jobFields(job *Job, fields ...interface{}) []interface{} {
+	return p.fields(jobFields(job, fields...)...)
+}
@@ -0,0 +1,76 @@
+package goworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFormatFields(t *testing.T) {
+	for _, tt := range []struct {
+		fields   []interface{}
+		expected string
+	}{
+		{nil, "msg"},
+		{[]interface{}{"queue", "high", "jobs", 3}, "msg queue=high jobs=3"},
+		{[]interface{}{"error", errors.New("connection refused"), "duration", time.Second}, `msg error="connection refused" duration=1s`},
+		{[]interface{}{"job", ""}, `msg job=""`},
+		{[]interface{}{"queue"}, "msg !BADKEY=queue"},
+		{[]interface{}{1, "queue", "high"}, "msg !BADKEY=1 queue=high"},
+	} {
+		if actual := formatFields("msg", tt.fields); actual != tt.expected {
+			t.Errorf("%v: expected %s, actual %s", tt.fields, tt.expected, actual)
+		}
+	}
+}
+
+func TestJobFields(t *testing.T) {
+	for _, tt := range []struct {
+		job      Job
+		expected []interface{}
+	}{
+		{
+			Job{Queue: "high", Payload: Payload{Class: "MyClass", Args: []interface{}{"hi"}}},
+			[]interface{}{"queue", "high", "class", "MyClass", "error", "failed"},
+		},
+		{
+			Job{Queue: "high", Payload: Payload{
+				Class: "ActiveJob::QueueAdapters::ResqueAdapter::JobWrapper",
+				Args:  []interface{}{map[string]interface{}{"job_class": "MyJob", "job_id": "b3a1f9"}},
+			}},
+			[]interface{}{"queue", "high", "class", "ActiveJob::QueueAdapters::ResqueAdapter::JobWrapper", "job", "b3a1f9", "error", "failed"},
+		},
+	} {
+		if actual := jobFields(&tt.job, "error", "failed"); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%v: expected %v, actual %v", tt.job, tt.expected, actual)
+		}
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := SlogLogger(slog.New(slog.NewJSONHandler(&buffer, nil)))
+	w := &worker{process: process{Hostname: "hostname", Pid: 12345, ID: "0", Queues: []string{"high"}}}
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+	logger.Info("Job done", w.jobFields(job, "duration", time.Second)...)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]interface{}{
+		"msg":      "Job done",
+		"worker":   "hostname:12345-0:high",
+		"queue":    "high",
+		"class":    "MyClass",
+		"duration": float64(time.Second),
+	} {
+		if record[key] != expected {
+			t.Errorf("%s: expected %v, actual %v", key, expected, record[key])
+		}
+	}
+}
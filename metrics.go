@@ -0,0 +1,214 @@
+package goworker
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/context"
+)
+
+// metrics are the Prometheus metrics of a client. Queue
+// depths and pause states are read from Redis when the
+// metrics are collected, everything else is recorded as it
+// happens. Every metric has the namespace of the client as
+// a constant label, so that the metrics of clients with
+// different namespaces can be registered together.
+type metrics struct {
+	client *Client
+
+	processed   *prometheus.CounterVec
+	failed      *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	pollLatency prometheus.Histogram
+	busy        prometheus.Gauge
+	poolWait    prometheus.Histogram
+	connRetries prometheus.Counter
+	failovers   prometheus.Counter
+
+	queueDepth *prometheus.Desc
+}
+
+func newMetrics(client *Client) *metrics {
+	labels := prometheus.Labels{"namespace": client.Namespace()}
+	if labels["namespace"] == "" {
+		labels["namespace"] = defaultNamespace
+	}
+	return &metrics{
+		client: client,
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "goworker",
+			Name:        "jobs_processed_total",
+			Help:        "Jobs which succeeded.",
+			ConstLabels: labels,
+		}, []string{"class", "queue"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "goworker",
+			Name:        "jobs_failed_total",
+			Help:        "Jobs which failed, including those retried.",
+			ConstLabels: labels,
+		}, []string{"class", "queue"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   "goworker",
+			Name:        "job_duration_seconds",
+			Help:        "How long jobs ran.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.005, 4, 10),
+		}, []string{"class", "queue"}),
+		pollLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   "goworker",
+			Name:        "poll_duration_seconds",
+			Help:        "How long a single fetch of a job from the queues took, including blocking.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.0005, 4, 10),
+		}),
+		busy: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "goworker",
+			Name:        "busy_workers",
+			Help:        "Workers running a job.",
+			ConstLabels: labels,
+		}),
+		poolWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   "goworker",
+			Name:        "pool_wait_seconds",
+			Help:        "How long getting a connection from the Redis pool took.",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}),
+		connRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "goworker",
+			Name:        "connection_retries_total",
+			Help:        "Attempts of GetConn which failed and were retried.",
+			ConstLabels: labels,
+		}),
+		failovers: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "goworker",
+			Name:        "connection_failovers_total",
+			Help:        "Pooled connections dropped because their server stopped being the master.",
+			ConstLabels: labels,
+		}),
+		queueDepth: prometheus.NewDesc(
+			"goworker_queue_depth",
+			"Jobs waiting on a known queue.",
+			[]string{"queue", "paused"},
+			labels,
+		),
+	}
+}
+
+func (m *metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.processed,
+		m.failed,
+		m.duration,
+		m.pollLatency,
+		m.busy,
+		m.poolWait,
+		m.connRetries,
+		m.failovers,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range m.collectors() {
+		collector.Describe(ch)
+	}
+	ch <- m.queueDepth
+}
+
+// Collect implements prometheus.Collector.
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range m.collectors() {
+		collector.Collect(ch)
+	}
+
+	if !m.client.isInitialized() {
+		return
+	}
+	stats, err := m.client.QueueStats()
+	if err != nil {
+		m.client.logger.Error("Error collecting queue metrics", "error", err)
+		return
+	}
+	for _, stat := range stats {
+		paused := "false"
+		if stat.Paused {
+			paused = "true"
+		}
+		ch <- prometheus.MustNewConstMetric(m.queueDepth, prometheus.GaugeValue, float64(stat.Size), stat.Name, paused)
+	}
+}
+
+// observe records the outcome of a job which ran for the
+// given duration.
+func (m *metrics) observe(job *Job, err error, duration time.Duration) {
+	m.duration.WithLabelValues(job.Payload.Class, job.Queue).Observe(duration.Seconds())
+	if err != nil {
+		m.failed.WithLabelValues(job.Payload.Class, job.Queue).Inc()
+	} else {
+		m.processed.WithLabelValues(job.Payload.Class, job.Queue).Inc()
+	}
+}
+
+// Collector returns the Prometheus metrics of the default
+// client.
+func Collector() prometheus.Collector {
+	return defaultClient.Collector()
+}
+
+// Collector returns the Prometheus metrics of the client:
+// jobs processed and failed, job durations, poll latency,
+// busy workers, connection pool waits, retries and
+// failovers, and the depth of every known queue. Register it
+// with a prometheus.Registerer, or set MetricsAddr to let
+// Work serve it.
+//
+// The namespace label is taken from the settings when the
+// metrics are first used, so the default client should only
+// be asked for them after the flags are parsed.
+func (c *Client) Collector() prometheus.Collector {
+	return c.stats()
+}
+
+// stats returns the metrics of the client, creating them on
+// first use.
+func (c *Client) stats() *metrics {
+	c.metricsOnce.Do(func() {
+		c.metrics = newMetrics(c)
+	})
+	return c.metrics
+}
+
+// serveMetrics serves the metrics of the client under
+// /metrics on addr until the returned function is called.
+func (c *Client) serveMetrics(addr string) (func(), error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(c.stats()); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux}
+
+	c.logger.Info("Serving metrics", "addr", listener.Addr().String())
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			c.logger.Error("Error serving metrics", "addr", addr, "error", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
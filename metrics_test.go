@@ -0,0 +1,74 @@
+package goworker
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsObserve(t *testing.T) {
+	client := NewClient(WorkerSettings{})
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+	client.stats().observe(job, nil, time.Second)
+	client.stats().observe(job, nil, time.Second)
+	client.stats().observe(job, errors.New("failed"), time.Second)
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(client.Collector()); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.GetCounter() != nil:
+				values[family.GetName()] += metric.GetCounter().GetValue()
+			case metric.GetHistogram() != nil:
+				values[family.GetName()] += float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	for name, expected := range map[string]float64{
+		"goworker_jobs_processed_total": 2,
+		"goworker_jobs_failed_total":    1,
+		"goworker_job_duration_seconds": 3,
+	} {
+		if values[name] != expected {
+			t.Errorf("%s: expected %v, actual %v", name, expected, values[name])
+		}
+	}
+}
+
+func TestMetricsRegisterClients(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	for _, namespace := range []string{"resque:", "other:"} {
+		client := NewClient(WorkerSettings{Namespace: namespace})
+		if err := registry.Register(client.Collector()); err != nil {
+			t.Errorf("%s: %v", namespace, err)
+		}
+	}
+}
+
+func TestClientServeMetricsListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client := NewClient(WorkerSettings{Logger: SeelogLogger(seelog.Disabled)})
+	if stop, err := client.serveMetrics(listener.Addr().String()); err == nil {
+		stop()
+		t.Error("expected serving metrics on a bound address to fail")
+	}
+}
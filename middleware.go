@@ -0,0 +1,158 @@
+package goworker
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Middleware wraps the handler of a job, e.g. to log, trace
+// or authorize it. A middleware calls next to run the job,
+// and may change the context, the job or the error on the
+// way.
+//
+// Every job runs through the built-in middleware first,
+// which records its outcome in Redis, traces it, runs its
+// hooks, applies its timeout and recovers panics. It then
+// runs through the global and the class middleware, in the
+// order they were added.
+type Middleware func(next Handler) Handler
+
+// Use adds middleware run around every job of the default
+// client.
+func Use(middleware ...Middleware) {
+	defaultClient.Use(middleware...)
+}
+
+// UseClass adds middleware run around the jobs of a class
+// of the default client.
+func UseClass(class string, middleware ...Middleware) {
+	defaultClient.UseClass(class, middleware...)
+}
+
+// Use adds middleware run around every job. Global
+// middleware runs around the middleware of the classes.
+func (c *Client) Use(middleware ...Middleware) {
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// UseClass adds middleware run around the jobs of a class.
+func (c *Client) UseClass(class string, middleware ...Middleware) {
+	c.classMiddleware[class] = append(c.classMiddleware[class], middleware...)
+}
+
+// chain wraps the handler of the class in its middleware.
+// The first middleware added runs first.
+func (c *Client) chain(class string, handler Handler) Handler {
+	classMiddleware := c.classMiddleware[class]
+	for i := len(classMiddleware) - 1; i >= 0; i-- {
+		handler = classMiddleware[i](handler)
+	}
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		handler = c.middleware[i](handler)
+	}
+	return handler
+}
+
+// recordFailures is the outermost built-in middleware. It
+// records the job as running, and then as succeeded, failed
+// or retried, unless a shutdown cancels the job and it is
+// requeued instead.
+func (w *worker) recordFailures(next Handler) Handler {
+	return func(ctx context.Context, job *Job) (err error) {
+		requeued := false
+		defer func() {
+			if requeued {
+				return
+			}
+			conn, errCon := w.client.GetConn()
+			if errCon != nil {
+				w.client.logger.Error("Error on getting connection in worker on finish", w.jobFields(job, "error", errCon)...)
+				return
+			} else {
+				w.finish(conn, job, err)
+				w.client.PutConn(conn)
+			}
+		}()
+
+		conn, err := w.client.GetConn()
+		if err != nil {
+			w.client.logger.Error("Error on getting connection in worker on start", w.jobFields(job, "error", err)...)
+			return err
+		} else {
+			w.start(conn, job)
+			if err = w.beginAttempt(conn, job); err != nil {
+				w.client.logger.Error("Error counting attempts", w.jobFields(job, "error", err)...)
+			}
+			w.client.PutConn(conn)
+		}
+
+		w.client.stats().busy.Inc()
+		start := time.Now()
+		err = next(ctx, job)
+		w.client.stats().busy.Dec()
+		defer func() {
+			if requeued {
+				return
+			}
+			duration := time.Since(start)
+			w.client.stats().observe(job, err, duration)
+			if err != nil {
+				w.client.logger.Warn("Job failed", w.jobFields(job, "duration", duration, "error", err)...)
+			} else {
+				w.client.logger.Debug("Job done", w.jobFields(job, "duration", duration)...)
+			}
+		}()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() == context.Canceled {
+			atomic.AddInt32(&w.client.cancelled, 1)
+			if w.client.settings.ShutdownRequeue {
+				w.abandon(job)
+				requeued = true
+				return err
+			}
+			err = errorShutdownCancelled
+		}
+		return err
+	}
+}
+
+// limitTime is the built-in middleware which abandons a job
+// running longer than its timeout. The rest of the chain
+// runs in its own goroutine, see call.
+func (w *worker) limitTime(next Handler) Handler {
+	return func(ctx context.Context, job *Job) error {
+		jobCtx := ctx
+		timeout := w.client.jobTimeout(job)
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			jobCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		err := w.call(jobCtx, job, next)
+		if err != nil && ctx.Err() == nil && jobCtx.Err() == context.DeadlineExceeded {
+			err = &TimeoutError{Class: job.Payload.Class, Queue: job.Queue, Timeout: timeout}
+			w.client.logger.Error("Job timed out", w.jobFields(job, "timeout", timeout)...)
+		}
+		return err
+	}
+}
+
+// recoverPanics is the built-in middleware which turns a
+// panic of the handler, or of any middleware after it, into
+// a PanicError.
+func (w *worker) recoverPanics(next Handler) Handler {
+	return func(ctx context.Context, job *Job) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = newPanicError(r)
+				w.client.logger.Error("Panic in job", w.jobFields(job, "error", err)...)
+			}
+		}()
+		return next(ctx, job)
+	}
+}
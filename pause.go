@@ -0,0 +1,99 @@
+package goworker
+
+import (
+	"fmt"
+	"time"
+)
+
+// Pause stops the default client from fetching jobs.
+func Pause() {
+	defaultClient.Pause()
+}
+
+// Resume lets the default client fetch jobs again.
+func Resume() {
+	defaultClient.Resume()
+}
+
+// Paused tells whether the default client is paused.
+func Paused() bool {
+	return defaultClient.Paused()
+}
+
+// Pause stops the poller from fetching jobs until Resume is
+// called, like the USR2 signal does. Running jobs are not
+// affected. While paused, the poller records the time it
+// paused in resque:worker:<poller-id>:paused.
+func (c *Client) Pause() {
+	c.pauseMutex.Lock()
+	defer c.pauseMutex.Unlock()
+
+	if c.resumed == nil {
+		c.logger.Info("Pausing job fetching")
+		c.resumed = make(chan struct{})
+	}
+}
+
+// Resume lets the poller fetch jobs again after Pause, like
+// the CONT signal does.
+func (c *Client) Resume() {
+	c.pauseMutex.Lock()
+	defer c.pauseMutex.Unlock()
+
+	if c.resumed != nil {
+		c.logger.Info("Resuming job fetching")
+		close(c.resumed)
+		c.resumed = nil
+	}
+}
+
+// Paused tells whether the client is paused.
+func (c *Client) Paused() bool {
+	return c.pausing() != nil
+}
+
+// pausing returns a channel which is closed on resume, or
+// nil when the client is not paused.
+func (c *Client) pausing() <-chan struct{} {
+	c.pauseMutex.Lock()
+	defer c.pauseMutex.Unlock()
+
+	return c.resumed
+}
+
+func (p *process) pausedKey() string {
+	return fmt.Sprintf("%sworker:%s:paused", p.client.Namespace(), p)
+}
+
+// pause waits until the client resumes or quit is closed,
+// keeping the pause visible in Redis meanwhile. It returns
+// false when quit was closed.
+func (p *poller) pause(resumed <-chan struct{}, quit <-chan bool) bool {
+	p.setPaused(true)
+	defer p.setPaused(false)
+
+	select {
+	case <-quit:
+		return false
+	case <-resumed:
+		return true
+	}
+}
+
+func (p *poller) setPaused(paused bool) {
+	conn, err := p.client.GetConn()
+	if err != nil {
+		p.client.logger.Error("Error on getting connection in poller", p.fields("error", err)...)
+		return
+	}
+	defer p.client.PutConn(conn)
+
+	if paused {
+		_, err = conn.Do("SET", p.pausedKey(), time.Now().Format(time.RFC3339))
+	} else {
+		_, err = conn.Do("DEL", p.pausedKey())
+	}
+	if err != nil {
+		p.client.logger.Error("Error recording pause of poller", p.fields("error", err)...)
+	}
+}
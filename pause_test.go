@@ -0,0 +1,46 @@
+package goworker
+
+import (
+	"testing"
+
+	"github.com/cihub/seelog"
+)
+
+func TestClientPause(t *testing.T) {
+	// pausing must work before the client is initialized
+	client := NewClient(WorkerSettings{Logger: SeelogLogger(seelog.Disabled)})
+
+	if client.Paused() {
+		t.Fatal("expected a new client not to be paused")
+	}
+
+	client.Pause()
+	resumed := client.pausing()
+	if !client.Paused() || resumed == nil {
+		t.Fatal("expected the client to be paused")
+	}
+	client.Pause()
+	if client.pausing() != resumed {
+		t.Error("expected pausing twice to keep the pause")
+	}
+
+	client.Resume()
+	if client.Paused() {
+		t.Error("expected the client to be resumed")
+	}
+	select {
+	case <-resumed:
+	default:
+		t.Error("expected resuming to close the channel of the pause")
+	}
+	client.Resume()
+}
+
+func TestClientPauseDefaultLogger(t *testing.T) {
+	client := NewClient(WorkerSettings{})
+	if client.logger == nil {
+		t.Fatal("expected a new client to have a logger")
+	}
+	client.Pause()
+	client.Resume()
+}
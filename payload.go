@@ -3,4 +3,7 @@ package goworker
 type Payload struct {
 	Class string        `json:"class"`
 	Args  []interface{} `json:"args"`
+	// TraceContext carries the W3C trace context of the code
+	// which enqueued the job. Resque ignores it.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
 }
@@ -4,16 +4,34 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// queuesRefreshInterval is how often the poller reads the
+// registered queues when the queues are dynamic.
+const queuesRefreshInterval = 5 * time.Second
+
+// minBlockSlice and maxBlockSlice bound how long BLMOVE
+// blocks on a single queue in reliable mode, see blockMove.
+const (
+	minBlockSlice = 100 * time.Millisecond
+	maxBlockSlice = time.Second
 )
 
 type poller struct {
 	process
 	isStrict bool
+
+	refreshed time.Time
 }
 
-func newPoller(queues []string, isStrict bool) (*poller, error) {
-	process, err := newProcess("poller", queues)
+func newPoller(client *Client, queues []string, isStrict bool) (*poller, error) {
+	process, err := newProcess(client, "poller", queues)
 	if err != nil {
 		return nil, err
 	}
@@ -24,59 +42,304 @@ func newPoller(queues []string, isStrict bool) (*poller, error) {
 }
 
 func (p *poller) getJob(conn *RedisConn) (*Job, error) {
-	for _, queue := range p.queues(p.isStrict) {
-		logger.Debugf("Checking %s", queue)
+	queues, err := p.unpausedQueues(conn, p.queues(p.isStrict))
+	if err != nil {
+		return nil, err
+	}
+	return p.getJobFrom(conn, queues)
+}
 
-		reply, err := conn.Do("LPOP", fmt.Sprintf("%squeue:%s", workerSettings.Namespace, queue))
+// getJobFrom fetches the first job found on the queues.
+func (p *poller) getJobFrom(conn *RedisConn, queues []string) (*Job, error) {
+	for _, queue := range queues {
+		p.client.logger.Debug("Checking queue", p.fields("queue", queue)...)
+
+		var reply interface{}
+		var err error
+		if p.client.settings.Reliable {
+			reply, err = p.fetch(conn, queue)
+		} else {
+			reply, err = conn.Do("LPOP", fmt.Sprintf("%squeue:%s", p.client.Namespace(), queue))
+		}
 		if err != nil {
 			return nil, err
 		}
 		if reply != nil {
-			logger.Debugf("Found job on %s", queue)
+			return p.decodeJob(queue, reply.([]byte))
+		}
+	}
 
-			job := &Job{Queue: queue}
+	return nil, nil
+}
 
-			decoder := json.NewDecoder(bytes.NewReader(reply.([]byte)))
-			if workerSettings.UseNumber {
-				decoder.UseNumber()
-			}
+// blockJob waits up to timeout for a job on any of the
+// queues, preferring them in the order returned by
+// p.queues, or until quit is closed. BLPOP blocks with a
+// granularity of seconds, so timeout is rounded up to a
+// whole second.
+func (p *poller) blockJob(conn *RedisConn, timeout time.Duration, quit <-chan bool) (*Job, error) {
+	seconds := int(math.Ceil(timeout.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	// leave the connection enough time to receive the reply
+	// after Redis stops blocking
+	readTimeout := time.Duration(seconds)*time.Second + p.client.settings.Timeout
 
-			if err := decoder.Decode(&job.Payload); err != nil {
-				return nil, err
-			}
-			return job, nil
+	queues, err := p.unpausedQueues(conn, p.queues(p.isStrict))
+	if err != nil {
+		return nil, err
+	}
+	if len(queues) == 0 {
+		// nothing to block on until queues are registered
+		select {
+		case <-quit:
+		case <-time.After(time.Duration(seconds) * time.Second):
 		}
+		return nil, nil
 	}
 
-	return nil, nil
+	// weighted queues repeat, blocking only needs the first
+	// occurrence to decide the priority
+	distinct := []string{}
+	seen := map[string]bool{}
+	for _, queue := range queues {
+		if !seen[queue] {
+			seen[queue] = true
+			distinct = append(distinct, queue)
+		}
+	}
+
+	if p.client.settings.Reliable {
+		return p.blockMove(conn, queues, distinct, timeout, quit)
+	}
+
+	args := []interface{}{}
+	for _, queue := range distinct {
+		args = append(args, fmt.Sprintf("%squeue:%s", p.client.Namespace(), queue))
+	}
+	args = append(args, seconds)
+
+	p.client.logger.Debug("Blocking on queues", p.fields("queues", p.Queues, "seconds", seconds)...)
+	reply, err := redis.ByteSlices(redis.DoWithTimeout(conn.Conn, readTimeout, "BLPOP", args...))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 2 {
+		return nil, fmt.Errorf("unexpected BLPOP reply with %d elements", len(reply))
+	}
+	queue := strings.TrimPrefix(string(reply[0]), fmt.Sprintf("%squeue:", p.client.Namespace()))
+	return p.decodeJob(queue, reply[1])
+}
+
+// blockMove waits for a job in reliable mode. BLMOVE accepts
+// a single source list, so after checking all queues it
+// blocks on them in turn, for a slice of timeout each, until
+// timeout expires or quit is closed. A job arriving on one
+// queue while the poller blocks on another waits at most
+// one slice.
+func (p *poller) blockMove(conn *RedisConn, queues, distinct []string, timeout time.Duration, quit <-chan bool) (*Job, error) {
+	job, err := p.getJobFrom(conn, queues)
+	if err != nil || job != nil {
+		return job, err
+	}
+
+	slice := timeout / time.Duration(len(distinct))
+	if slice > maxBlockSlice {
+		slice = maxBlockSlice
+	}
+	if slice < minBlockSlice {
+		slice = minBlockSlice
+	}
+	deadline := time.Now().Add(timeout)
+
+	for i := 0; ; i++ {
+		queue := distinct[i%len(distinct)]
+		p.client.logger.Debug("Blocking on queue", p.fields("queue", queue, "timeout", slice)...)
+		reply, err := redis.DoWithTimeout(
+			conn.Conn,
+			slice+p.client.settings.Timeout,
+			"BLMOVE",
+			fmt.Sprintf("%squeue:%s", p.client.Namespace(), queue),
+			p.inflightKey(queue),
+			"LEFT",
+			"RIGHT",
+			strconv.FormatFloat(slice.Seconds(), 'f', 3, 64),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if reply != nil {
+			return p.decodeJob(queue, reply.([]byte))
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-quit:
+			return nil, nil
+		default:
+		}
+	}
+}
+
+// unpausedQueues filters the paused queues out, keeping the
+// order and the weights of the others.
+func (p *poller) unpausedQueues(conn *RedisConn, queues []string) ([]string, error) {
+	if len(queues) == 0 {
+		return queues, nil
+	}
+
+	paused, err := p.client.pausedQueues(conn, queues)
+	if err != nil {
+		return nil, err
+	}
+	if len(paused) == 0 {
+		return queues, nil
+	}
+
+	unpaused := make([]string, 0, len(queues))
+	for _, queue := range queues {
+		if !paused[queue] {
+			unpaused = append(unpaused, queue)
+		}
+	}
+	return unpaused, nil
+}
+
+// refreshQueues resolves the dynamic queues against the
+// registered queues again when they are due, and in
+// reliable mode registers the in-flight lists of the new
+// ones.
+func (p *poller) refreshQueues(conn *RedisConn) error {
+	if !p.dynamic() || time.Since(p.refreshed) < queuesRefreshInterval {
+		return nil
+	}
+
+	registered, err := redis.Strings(conn.Do("SMEMBERS", p.client.queuesKey()))
+	if err != nil {
+		return err
+	}
+	p.refreshed = time.Now()
+
+	queues := p.Queues
+	if p.client.settings.DynamicQueues {
+		queues = append(queues[:len(queues):len(queues)], "*")
+	}
+	resolved := resolveQueues(queues, registered)
+
+	if p.resolved != nil && fmt.Sprint(resolved) == fmt.Sprint(p.resolved) {
+		return nil
+	}
+	p.client.logger.Info("Resolved queues", p.fields("queues", p.Queues, "resolved", resolved)...)
+	p.resolved = resolved
+
+	if p.client.settings.Reliable {
+		return p.registerInflight(conn)
+	}
+	return nil
+}
+
+// invalidPayloadError is returned for a fetched payload
+// which cannot be decoded. The job is already off its queue
+// by then, see failInvalid.
+type invalidPayloadError struct {
+	queue   string
+	payload []byte
+	err     error
+}
+
+func (e *invalidPayloadError) Error() string {
+	return fmt.Sprintf("invalid payload on %s: %v", e.queue, e.err)
+}
+
+func (p *poller) decodeJob(queue string, payload []byte) (*Job, error) {
+	p.client.logger.Debug("Found job", p.fields("queue", queue)...)
+
+	job := &Job{Queue: queue}
+	if p.client.settings.Reliable {
+		job.raw = payload
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	if p.client.settings.UseNumber {
+		decoder.UseNumber()
+	}
+
+	if err := decoder.Decode(&job.Payload); err != nil {
+		return nil, &invalidPayloadError{queue: queue, payload: payload, err: err}
+	}
+	return job, nil
+}
+
+// failInvalid records a payload which cannot be decoded in
+// the failed list, as the only argument of a job without a
+// class so that resque-web can show it, and removes it from
+// the in-flight list in reliable mode. Otherwise it would be
+// recovered and fetched again on every start.
+func (p *poller) failInvalid(conn *RedisConn, invalid *invalidPayloadError) error {
+	buffer, err := json.Marshal(&failure{
+		FailedAt:  time.Now(),
+		Payload:   Payload{Args: []interface{}{string(invalid.payload)}},
+		Exception: exception(invalid.err),
+		Error:     invalid.Error(),
+		Backtrace: backtrace(invalid.err),
+		Worker:    &worker{process: p.process},
+		Queue:     invalid.queue,
+	})
+	if err != nil {
+		return err
+	}
+
+	conn.Send("MULTI")
+	conn.Send("RPUSH", p.client.failedKey(), buffer)
+	if p.client.settings.Reliable {
+		conn.Send("LREM", p.inflightKey(invalid.queue), 1, invalid.payload)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return err
+	}
+	return p.fail(conn)
 }
 
 func (p *poller) poll(interval time.Duration, quit <-chan bool) <-chan *Job {
 	jobs := make(chan *Job)
 
-	conn, err := GetConn()
+	conn, err := p.client.GetConn()
 	if err != nil {
-		logger.Criticalf("Error on getting connection in poller %s: %v", p, err)
+		p.client.logger.Error("Error on getting connection in poller", p.fields("error", err)...)
 		close(jobs)
 		return jobs
 	} else {
 		p.open(conn)
 		p.start(conn)
-		PutConn(conn)
+		if p.client.settings.Reliable {
+			if err := p.registerInflight(conn); err != nil {
+				p.client.logger.Error("Error registering in-flight lists", p.fields("error", err)...)
+				p.client.PutConn(conn)
+				close(jobs)
+				return jobs
+			}
+		}
+		p.client.PutConn(conn)
 	}
 
 	go func() {
 		defer func() {
 			close(jobs)
 
-			conn, err := GetConn()
+			conn, err := p.client.GetConn()
 			if err != nil {
-				logger.Criticalf("Error on getting connection in poller %s: %v", p, err)
+				p.client.logger.Error("Error on getting connection in poller", p.fields("error", err)...)
 				return
 			} else {
 				p.finish(conn)
 				p.close(conn)
-				PutConn(conn)
+				p.client.PutConn(conn)
 			}
 		}()
 
@@ -85,48 +348,71 @@ func (p *poller) poll(interval time.Duration, quit <-chan bool) <-chan *Job {
 			case <-quit:
 				return
 			default:
-				conn, err := GetConn()
+				if resumed := p.client.pausing(); resumed != nil {
+					if !p.pause(resumed, quit) {
+						return
+					}
+					continue
+				}
+
+				conn, err := p.client.GetConn()
 				if err != nil {
-					logger.Criticalf("Error on getting connection in poller %s: %v", p, err)
+					p.client.logger.Error("Error on getting connection in poller", p.fields("error", err)...)
 					return
 				}
 
-				job, err := p.getJob(conn)
+				if err := p.refreshQueues(conn); err != nil {
+					p.client.logger.Error("Error reading registered queues in poller", p.fields("error", err)...)
+				}
+
+				var job *Job
+				start := time.Now()
+				if p.client.settings.Blocking {
+					job, err = p.blockJob(conn, interval, quit)
+				} else {
+					job, err = p.getJob(conn)
+				}
+				p.client.stats().pollLatency.Observe(time.Since(start).Seconds())
+				if invalid, ok := err.(*invalidPayloadError); ok {
+					p.client.logger.Error("Dropping job with invalid payload", p.fields("queue", invalid.queue, "payload", string(invalid.payload), "error", invalid.err)...)
+					if err := p.failInvalid(conn, invalid); err != nil {
+						p.client.logger.Error("Error recording invalid payload", p.fields("queue", invalid.queue, "error", err)...)
+					}
+					p.client.PutConn(conn)
+					continue
+				}
 				if err != nil {
-					logger.Criticalf("Error on %v getting job from %v: %v", p, p.Queues, err)
-					PutConn(conn)
+					p.client.logger.Error("Error getting job", p.fields("queues", p.Queues, "error", err)...)
+					p.client.PutConn(conn)
 					return
 				}
 				if job != nil {
-					conn.Send("INCR", fmt.Sprintf("%sstat:processed:%v", workerSettings.Namespace, p))
+					conn.Send("INCR", fmt.Sprintf("%sstat:processed:%v", p.client.Namespace(), p))
 					conn.Flush()
-					PutConn(conn)
+					p.client.PutConn(conn)
 					select {
 					case jobs <- job:
 					case <-quit:
-						buf, err := json.Marshal(job.Payload)
+						conn, err := p.client.GetConn()
 						if err != nil {
-							logger.Criticalf("Error requeueing %v: %v", job, err)
+							p.client.logger.Error("Error on getting connection in poller", p.fields("error", err)...)
 							return
 						}
-						conn, err := GetConn()
-						if err != nil {
-							logger.Criticalf("Error on getting connection in poller %s: %v", p, err)
-							return
+						if err := p.requeue(conn, job); err != nil {
+							p.client.logger.Error("Error requeueing job", p.jobFields(job, "error", err)...)
 						}
-
-						conn.Send("LPUSH", fmt.Sprintf("%squeue:%s", workerSettings.Namespace, job.Queue), buf)
-						conn.Flush()
-						PutConn(conn)
+						p.client.PutConn(conn)
 						return
 					}
 				} else {
-					PutConn(conn)
-					if workerSettings.ExitOnComplete {
+					p.client.PutConn(conn)
+					if p.client.settings.ExitOnComplete {
 						return
 					}
-					logger.Debugf("Sleeping for %v", interval)
-					logger.Debugf("Waiting for %v", p.Queues)
+					if p.client.settings.Blocking {
+						continue
+					}
+					p.client.logger.Debug("Waiting for jobs", p.fields("queues", p.Queues, "interval", interval)...)
 
 					timeout := time.After(interval)
 					select {
@@ -0,0 +1,43 @@
+package goworker
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cihub/seelog"
+)
+
+func TestPollerDecodeJob(t *testing.T) {
+	client := NewClient(WorkerSettings{UseNumber: true, Reliable: true})
+	client.logger = SeelogLogger(seelog.Disabled)
+	p := &poller{process: process{client: client}}
+	payload := []byte(`{"class":"MyClass","args":["hi",1]}`)
+	job, err := p.decodeJob("high", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Job{
+		Queue: "high",
+		Payload: Payload{
+			Class: "MyClass",
+			Args:  []interface{}{"hi", json.Number("1")},
+		},
+		raw: payload,
+	}
+	if !reflect.DeepEqual(job, expected) {
+		t.Errorf("expected %#v, actual %#v", expected, job)
+	}
+}
+
+func TestPollerDecodeJobInvalid(t *testing.T) {
+	client := NewClient(WorkerSettings{})
+	client.logger = SeelogLogger(seelog.Disabled)
+	p := &poller{process: process{client: client}}
+	_, err := p.decodeJob("high", []byte(`{"class":`))
+	invalid, ok := err.(*invalidPayloadError)
+	if !ok || invalid.queue != "high" || string(invalid.payload) != `{"class":` {
+		t.Errorf("expected an invalidPayloadError keeping the payload, actual %#v", err)
+	}
+}
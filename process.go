@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"path"
+	"sort"
 	"strings"
 	"time"
 )
@@ -13,9 +15,16 @@ type process struct {
 	Pid      int
 	ID       string
 	Queues   []string
+
+	// resolved holds the queues which Queues select among
+	// the registered ones when they contain patterns, or
+	// with -dynamic-queues.
+	resolved []string
+
+	client *Client
 }
 
-func newProcess(id string, queues []string) (*process, error) {
+func newProcess(client *Client, id string, queues []string) (*process, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
 		return nil, err
@@ -26,6 +35,7 @@ func newProcess(id string, queues []string) (*process, error) {
 		Pid:      os.Getpid(),
 		ID:       id,
 		Queues:   queues,
+		client:   client,
 	}, nil
 }
 
@@ -34,57 +44,142 @@ func (p *process) String() string {
 }
 
 func (p *process) open(conn *RedisConn) error {
-	conn.Send("SADD", fmt.Sprintf("%sworkers", workerSettings.Namespace), p)
-	conn.Send("SET", fmt.Sprintf("%sstat:processed:%v", workerSettings.Namespace, p), "0")
-	conn.Send("SET", fmt.Sprintf("%sstat:failed:%v", workerSettings.Namespace, p), "0")
+	conn.Send("SADD", fmt.Sprintf("%sworkers", p.client.Namespace()), p)
+	conn.Send("SET", fmt.Sprintf("%sstat:processed:%v", p.client.Namespace(), p), "0")
+	conn.Send("SET", fmt.Sprintf("%sstat:failed:%v", p.client.Namespace(), p), "0")
+	p.client.alive(conn, p)
 	conn.Flush()
 
+	p.client.workerHook(func(hooks WorkerHooks) {
+		if hooks.Open != nil {
+			hooks.Open(p.String())
+		}
+	})
+
 	return nil
 }
 
 func (p *process) close(conn *RedisConn) error {
-	logger.Infof("%v shutdown", p)
-	conn.Send("SREM", fmt.Sprintf("%sworkers", workerSettings.Namespace), p)
-	conn.Send("DEL", fmt.Sprintf("%sstat:processed:%s", workerSettings.Namespace, p))
-	conn.Send("DEL", fmt.Sprintf("%sstat:failed:%s", workerSettings.Namespace, p))
+	p.client.logger.Info("Shutdown", p.fields()...)
+	conn.Send("SREM", fmt.Sprintf("%sworkers", p.client.Namespace()), p)
+	conn.Send("DEL", fmt.Sprintf("%sstat:processed:%s", p.client.Namespace(), p))
+	conn.Send("DEL", fmt.Sprintf("%sstat:failed:%s", p.client.Namespace(), p))
+	p.client.dead(conn, p)
 	conn.Flush()
 
+	p.client.workerHook(func(hooks WorkerHooks) {
+		if hooks.Close != nil {
+			hooks.Close(p.String())
+		}
+	})
+
 	return nil
 }
 
 func (p *process) start(conn *RedisConn) error {
-	conn.Send("SET", fmt.Sprintf("%sworker:%s:started", workerSettings.Namespace, p), time.Now().String())
+	conn.Send("SET", fmt.Sprintf("%sworker:%s:started", p.client.Namespace(), p), time.Now().String())
 	conn.Flush()
 
 	return nil
 }
 
 func (p *process) finish(conn *RedisConn) error {
-	conn.Send("DEL", fmt.Sprintf("%sworker:%s", workerSettings.Namespace, p))
-	conn.Send("DEL", fmt.Sprintf("%sworker:%s:started", workerSettings.Namespace, p))
+	conn.Send("DEL", fmt.Sprintf("%sworker:%s", p.client.Namespace(), p))
+	conn.Send("DEL", fmt.Sprintf("%sworker:%s:started", p.client.Namespace(), p))
 	conn.Flush()
 
 	return nil
 }
 
 func (p *process) fail(conn *RedisConn) error {
-	conn.Send("INCR", fmt.Sprintf("%sstat:failed", workerSettings.Namespace))
-	conn.Send("INCR", fmt.Sprintf("%sstat:failed:%s", workerSettings.Namespace, p))
+	conn.Send("INCR", fmt.Sprintf("%sstat:failed", p.client.Namespace()))
+	conn.Send("INCR", fmt.Sprintf("%sstat:failed:%s", p.client.Namespace(), p))
 	conn.Flush()
 
 	return nil
 }
 
 func (p *process) queues(strict bool) []string {
+	active := p.activeQueues()
+
 	// If the queues order is strict then just return them.
 	if strict {
-		return p.Queues
+		return active
 	}
 
 	// If not then we want to to shuffle the queues before returning them.
-	queues := make([]string, len(p.Queues))
-	for i, v := range rand.Perm(len(p.Queues)) {
-		queues[i] = p.Queues[v]
+	queues := make([]string, len(active))
+	for i, v := range rand.Perm(len(active)) {
+		queues[i] = active[v]
 	}
 	return queues
 }
+
+// dynamic tells whether the queues of the process depend on
+// the registered queues.
+func (p *process) dynamic() bool {
+	if p.client != nil && p.client.settings.DynamicQueues {
+		return true
+	}
+	for _, queue := range p.Queues {
+		if isQueuePattern(queue) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeQueues returns the queues to process, which are the
+// resolved ones when the queues are dynamic. They stay empty
+// until the registered queues are read for the first time.
+func (p *process) activeQueues() []string {
+	if p.dynamic() {
+		return p.resolved
+	}
+	return p.Queues
+}
+
+// resolveQueues replaces the patterns among the queues with
+// the sorted registered queues matching them. A queue given
+// by name, or matched by an earlier pattern, is not matched
+// again by a later pattern, so * selects all the remaining
+// queues. Weights, i.e. repetitions of a pattern, apply to
+// every queue it matches.
+func resolveQueues(queues, registered []string) []string {
+	sorted := append([]string{}, registered...)
+	sort.Strings(sorted)
+
+	claimed := make(map[string]string, len(sorted))
+	for _, queue := range queues {
+		if !isQueuePattern(queue) {
+			claimed[queue] = queue
+		}
+	}
+	for _, pattern := range queues {
+		if !isQueuePattern(pattern) {
+			continue
+		}
+		for _, queue := range sorted {
+			if _, ok := claimed[queue]; ok {
+				continue
+			}
+			if matched, _ := path.Match(pattern, queue); matched {
+				claimed[queue] = pattern
+			}
+		}
+	}
+
+	resolved := []string{}
+	for _, queue := range queues {
+		if !isQueuePattern(queue) {
+			resolved = append(resolved, queue)
+			continue
+		}
+		for _, match := range sorted {
+			if claimed[match] == queue {
+				resolved = append(resolved, match)
+			}
+		}
+	}
+	return resolved
+}
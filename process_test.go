@@ -1,6 +1,8 @@
 package goworker
 
 import (
+	"fmt"
+	"sort"
 	"testing"
 )
 
@@ -31,3 +33,93 @@ func TestProcessString(t *testing.T) {
 		}
 	}
 }
+
+var resolveQueuesTests = []struct {
+	queues     []string
+	registered []string
+	expected   []string
+}{
+	{
+		[]string{"high", "low"},
+		[]string{"mailers", "high"},
+		[]string{"high", "low"},
+	},
+	{
+		[]string{"*"},
+		[]string{"reports_b", "mailers", "reports_a"},
+		[]string{"mailers", "reports_a", "reports_b"},
+	},
+	{
+		[]string{"high", "*"},
+		[]string{"low", "high", "mailers"},
+		[]string{"high", "low", "mailers"},
+	},
+	{
+		[]string{"reports_*", "reports_*", "*"},
+		[]string{"reports_b", "mailers", "reports_a"},
+		[]string{"reports_a", "reports_b", "reports_a", "reports_b", "mailers"},
+	},
+	{
+		[]string{"*", "reports_*"},
+		[]string{"reports_a", "mailers"},
+		[]string{"mailers", "reports_a"},
+	},
+	{
+		[]string{"tenant_?"},
+		[]string{"tenant_1", "tenant_22"},
+		[]string{"tenant_1"},
+	},
+	{
+		[]string{"reports_*"},
+		nil,
+		[]string{},
+	},
+}
+
+func TestResolveQueues(t *testing.T) {
+	for _, tt := range resolveQueuesTests {
+		actual := resolveQueues(tt.queues, tt.registered)
+		if fmt.Sprint(actual) != fmt.Sprint(tt.expected) {
+			t.Errorf("resolveQueues(%v, %v): expected %v, actual %v", tt.queues, tt.registered, tt.expected, actual)
+		}
+	}
+}
+
+func TestProcessQueuesResolved(t *testing.T) {
+	p := process{
+		Queues:   []string{"high", "high", "*"},
+		resolved: []string{"high", "high", "low", "mailers"},
+	}
+
+	expected := "[high high low mailers]"
+	if actual := fmt.Sprint(p.queues(true)); actual != expected {
+		t.Errorf("strict queues: expected %s, actual %s", expected, actual)
+	}
+
+	queues := p.queues(false)
+	sort.Strings(queues)
+	if actual := fmt.Sprint(queues); actual != expected {
+		t.Errorf("shuffled queues: expected %s, actual %s", expected, actual)
+	}
+
+	expected = "[high low mailers]"
+	if actual := fmt.Sprint(p.distinctQueues()); actual != expected {
+		t.Errorf("distinct queues: expected %s, actual %s", expected, actual)
+	}
+
+	p.Queues = []string{"high", "low"}
+	if actual := fmt.Sprint(p.queues(true)); actual != "[high low]" {
+		t.Errorf("static queues: expected [high low], actual %s", actual)
+	}
+}
+
+func TestSettingsParseDynamicQueues(t *testing.T) {
+	settings := WorkerSettings{DynamicQueues: true, IntervalFloat: 5}
+	if err := settings.parse(); err != nil {
+		t.Errorf("expected no error without queues, actual %v", err)
+	}
+	settings = WorkerSettings{IntervalFloat: 5}
+	if err := settings.parse(); err != errorEmptyQueues {
+		t.Errorf("expected %v without dynamic queues, actual %v", errorEmptyQueues, err)
+	}
+}
@@ -0,0 +1,450 @@
+package goworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// moveBatchSize bounds how many jobs a single call of
+// moveQueueScript moves, so that moving a large queue does
+// not block Redis for long.
+const moveBatchSize = 100
+
+var errorSameQueue = errors.New("cannot move jobs onto the queue they are on")
+
+// moveQueueScript moves a batch of jobs of a queue onto the
+// end of another queue, keeping their order. A queue moving
+// onto a queue which does not exist is renamed at once.
+//
+// KEYS: source queue, destination queue, queues set. ARGV:
+// destination queue name, batch size.
+var moveQueueScript = redis.NewScript(3, `
+local moved = 0
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	moved = redis.call('LLEN', KEYS[1])
+	if moved > 0 then
+		redis.call('RENAME', KEYS[1], KEYS[2])
+	end
+else
+	for i = 1, tonumber(ARGV[2]) do
+		if not redis.call('LMOVE', KEYS[1], KEYS[2], 'LEFT', 'RIGHT') then
+			break
+		end
+		moved = moved + 1
+	end
+end
+if moved > 0 then
+	redis.call('SADD', KEYS[3], ARGV[1])
+end
+return moved
+`)
+
+// moveJobScript moves every copy of a job from a queue onto
+// the end of another queue.
+//
+// KEYS: source queue, destination queue, queues set. ARGV:
+// job, destination queue name.
+var moveJobScript = redis.NewScript(3, `
+local moved = redis.call('LREM', KEYS[1], 0, ARGV[1])
+for i = 1, moved do
+	redis.call('RPUSH', KEYS[2], ARGV[1])
+end
+if moved > 0 then
+	redis.call('SADD', KEYS[3], ARGV[2])
+end
+return moved
+`)
+
+// QueueStat describes a queue.
+type QueueStat struct {
+	Name   string
+	Size   int
+	Paused bool
+}
+
+// Queues returns the known queues of the default client.
+func Queues() ([]string, error) {
+	return defaultClient.Queues()
+}
+
+// QueueSize returns the number of jobs waiting on a queue
+// of the default client.
+func QueueSize(queue string) (int, error) {
+	return defaultClient.QueueSize(queue)
+}
+
+// QueueSizes returns the number of jobs waiting on every
+// known queue of the default client.
+func QueueSizes() (map[string]int, error) {
+	return defaultClient.QueueSizes()
+}
+
+// QueueStats describes every known queue of the default
+// client.
+func QueueStats() ([]QueueStat, error) {
+	return defaultClient.QueueStats()
+}
+
+// PauseQueue pauses a queue of the default client.
+func PauseQueue(queue string) error {
+	return defaultClient.PauseQueue(queue)
+}
+
+// UnpauseQueue unpauses a queue of the default client.
+func UnpauseQueue(queue string) error {
+	return defaultClient.UnpauseQueue(queue)
+}
+
+// QueuePaused tells whether a queue of the default client
+// is paused.
+func QueuePaused(queue string) (bool, error) {
+	return defaultClient.QueuePaused(queue)
+}
+
+// Peek returns jobs waiting on a queue of the default
+// client.
+func Peek(queue string, start, count int) ([]Payload, error) {
+	return defaultClient.Peek(queue, start, count)
+}
+
+// Dequeue removes jobs from a queue of the default client.
+func Dequeue(queue, class string, args ...interface{}) (int, error) {
+	return defaultClient.Dequeue(queue, class, args...)
+}
+
+// MoveJobs moves jobs between queues of the default client.
+func MoveJobs(from, to, class string, args ...interface{}) (int, error) {
+	return defaultClient.MoveJobs(from, to, class, args...)
+}
+
+// Queues returns the sorted names of the queues known to
+// resque, i.e. the members of the resque:queues set.
+func (c *Client) Queues() ([]string, error) {
+	conn, err := c.initConn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.PutConn(conn)
+
+	queues, err := redis.Strings(conn.Do("SMEMBERS", c.queuesKey()))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(queues)
+	return queues, nil
+}
+
+// QueueSize returns the number of jobs waiting on a queue.
+func (c *Client) QueueSize(queue string) (int, error) {
+	conn, err := c.initConn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.PutConn(conn)
+
+	return redis.Int(conn.Do("LLEN", c.queueKey(queue)))
+}
+
+// QueueSizes returns the number of jobs waiting on every
+// known queue.
+func (c *Client) QueueSizes() (map[string]int, error) {
+	stats, err := c.QueueStats()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int, len(stats))
+	for _, stat := range stats {
+		sizes[stat.Name] = stat.Size
+	}
+	return sizes, nil
+}
+
+// QueueStats describes every known queue, sorted by name.
+func (c *Client) QueueStats() ([]QueueStat, error) {
+	queues, err := c.Queues()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.initConn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.PutConn(conn)
+
+	stats := make([]QueueStat, len(queues))
+	if len(queues) == 0 {
+		return stats, nil
+	}
+	for _, queue := range queues {
+		conn.Send("LLEN", c.queueKey(queue))
+	}
+	sizes, err := redis.Ints(conn.Do(""))
+	if err != nil {
+		return nil, err
+	}
+	paused, err := c.pausedQueues(conn, queues)
+	if err != nil {
+		return nil, err
+	}
+	for i, queue := range queues {
+		stats[i] = QueueStat{Name: queue, Size: sizes[i], Paused: paused[queue]}
+	}
+	return stats, nil
+}
+
+// PauseQueue stops every goworker process from fetching the
+// jobs of a queue until it is unpaused. The jobs stay on the
+// queue meanwhile. The queue is paused the way the
+// resque-pause plugin does it, so Ruby workers using it
+// honor the pause too.
+func (c *Client) PauseQueue(queue string) error {
+	conn, err := c.initConn()
+	if err != nil {
+		return err
+	}
+	defer c.PutConn(conn)
+
+	_, err = conn.Do("SET", c.queuePausedKey(queue), "true")
+	return err
+}
+
+// UnpauseQueue lets processes fetch the jobs of a paused
+// queue again.
+func (c *Client) UnpauseQueue(queue string) error {
+	conn, err := c.initConn()
+	if err != nil {
+		return err
+	}
+	defer c.PutConn(conn)
+
+	_, err = conn.Do("DEL", c.queuePausedKey(queue))
+	return err
+}
+
+// QueuePaused tells whether a queue is paused.
+func (c *Client) QueuePaused(queue string) (bool, error) {
+	conn, err := c.initConn()
+	if err != nil {
+		return false, err
+	}
+	defer c.PutConn(conn)
+
+	return redis.Bool(conn.Do("EXISTS", c.queuePausedKey(queue)))
+}
+
+// Peek returns up to count jobs waiting on a queue, starting
+// at start, without removing them. The first job to be
+// processed is at 0.
+func (c *Client) Peek(queue string, start, count int) ([]Payload, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+
+	conn, err := c.initConn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.PutConn(conn)
+
+	entries, err := redis.ByteSlices(conn.Do("LRANGE", c.queueKey(queue), start, start+count-1))
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make([]Payload, len(entries))
+	for i, entry := range entries {
+		if err := c.decodePayload(entry, &payloads[i]); err != nil {
+			return nil, err
+		}
+	}
+	return payloads, nil
+}
+
+// Dequeue removes the jobs of the class from a queue and
+// returns how many were removed. When args are given, only
+// the jobs with the same arguments are removed, as with
+// Resque.dequeue.
+func (c *Client) Dequeue(queue, class string, args ...interface{}) (int, error) {
+	conn, err := c.initConn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.PutConn(conn)
+
+	entries, err := c.matchJobs(conn, queue, class, args)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		count, err := redis.Int(conn.Do("LREM", c.queueKey(queue), 0, entry))
+		if err != nil {
+			return removed, err
+		}
+		removed += count
+	}
+	return removed, nil
+}
+
+// MoveJobs moves jobs from one queue onto the end of another
+// and returns how many were moved. An empty class moves all
+// jobs, otherwise the jobs are selected as by Dequeue. Jobs
+// are moved in batches, so jobs pushed meanwhile may move
+// along. Moving requires Redis 6.2 for LMOVE.
+func (c *Client) MoveJobs(from, to, class string, args ...interface{}) (int, error) {
+	if from == to {
+		return 0, errorSameQueue
+	}
+
+	conn, err := c.initConn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.PutConn(conn)
+
+	if class == "" {
+		moved := 0
+		for {
+			count, err := redis.Int(moveQueueScript.Do(conn.Conn, c.queueKey(from), c.queueKey(to), c.queuesKey(), to, moveBatchSize))
+			if err != nil {
+				return moved, err
+			}
+			moved += count
+			if count < moveBatchSize {
+				return moved, nil
+			}
+		}
+	}
+
+	entries, err := c.matchJobs(conn, from, class, args)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		count, err := redis.Int(moveJobScript.Do(conn.Conn, c.queueKey(from), c.queueKey(to), c.queuesKey(), entry, to))
+		if err != nil {
+			return moved, err
+		}
+		moved += count
+	}
+	return moved, nil
+}
+
+func (c *Client) queueKey(queue string) string {
+	return fmt.Sprintf("%squeue:%s", c.Namespace(), queue)
+}
+
+// queuePausedKey names the marker of a paused queue, as
+// named by resque-pause.
+func (c *Client) queuePausedKey(queue string) string {
+	return fmt.Sprintf("%spause:queue:%s", c.Namespace(), queue)
+}
+
+// pausedQueues returns which of the queues are paused.
+func (c *Client) pausedQueues(conn *RedisConn, queues []string) (map[string]bool, error) {
+	distinct := []string{}
+	keys := []interface{}{}
+	seen := make(map[string]bool, len(queues))
+	for _, queue := range queues {
+		if !seen[queue] {
+			seen[queue] = true
+			distinct = append(distinct, queue)
+			keys = append(keys, c.queuePausedKey(queue))
+		}
+	}
+
+	markers, err := redis.Values(conn.Do("MGET", keys...))
+	if err != nil {
+		return nil, err
+	}
+	paused := make(map[string]bool)
+	for i, marker := range markers {
+		if marker != nil {
+			paused[distinct[i]] = true
+		}
+	}
+	return paused, nil
+}
+
+// queuesKey names the set of known queues, which resque
+// keeps in sync with every push.
+func (c *Client) queuesKey() string {
+	return fmt.Sprintf("%squeues", c.Namespace())
+}
+
+func (c *Client) decodePayload(entry []byte, payload *Payload) error {
+	decoder := json.NewDecoder(bytes.NewReader(entry))
+	if c.settings.UseNumber {
+		decoder.UseNumber()
+	}
+	return decoder.Decode(payload)
+}
+
+// matchJobs returns the distinct jobs waiting on a queue
+// which have the class and, when given, the arguments.
+// Arguments are compared by their JSON encoding.
+func (c *Client) matchJobs(conn *RedisConn, queue, class string, args []interface{}) ([][]byte, error) {
+	var expected []byte
+	if len(args) > 0 {
+		var err error
+		if expected, err = json.Marshal(args); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := redis.ByteSlices(conn.Do("LRANGE", c.queueKey(queue), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var matches [][]byte
+	for _, entry := range entries {
+		if seen[string(entry)] {
+			continue
+		}
+		seen[string(entry)] = true
+
+		var payload struct {
+			Class string          `json:"class"`
+			Args  json.RawMessage `json:"args"`
+		}
+		if err := json.Unmarshal(entry, &payload); err != nil || payload.Class != class {
+			continue
+		}
+		if expected != nil && !sameJSON(payload.Args, expected) {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+	return matches, nil
+}
+
+// sameJSON compares two JSON documents regardless of
+// whitespace and the order of object keys.
+func sameJSON(a, b []byte) bool {
+	var x, y interface{}
+	decoder := json.NewDecoder(bytes.NewReader(a))
+	decoder.UseNumber()
+	if err := decoder.Decode(&x); err != nil {
+		return false
+	}
+	decoder = json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&y); err != nil {
+		return false
+	}
+	normalizedX, errX := json.Marshal(x)
+	normalizedY, errY := json.Marshal(y)
+	return errX == nil && errY == nil && bytes.Equal(normalizedX, normalizedY)
+}
@@ -3,6 +3,7 @@ package goworker
 import (
 	"errors"
 	"fmt"
+	"path"
 	"strconv"
 	"strings"
 )
@@ -10,6 +11,7 @@ import (
 var (
 	errorEmptyQueues      = errors.New("you must specify at least one queue")
 	errorNonNumericWeight = errors.New("the weight must be a numeric value")
+	errorInvalidPattern   = errors.New("invalid queue pattern")
 )
 
 type queuesFlag []string
@@ -24,6 +26,11 @@ func (q *queuesFlag) Set(value string) error {
 		if err != nil {
 			return err
 		}
+		if isQueuePattern(queue) {
+			if _, err := path.Match(queue, ""); err != nil {
+				return errorInvalidPattern
+			}
+		}
 
 		for i := 0; i < weight; i++ {
 			*q = append(*q, queue)
@@ -39,6 +46,13 @@ func (q *queuesFlag) String() string {
 	return fmt.Sprint(*q)
 }
 
+// isQueuePattern tells whether the queue is a glob pattern
+// such as * or reports_*, which selects the registered
+// queues matching it.
+func isQueuePattern(queue string) bool {
+	return strings.ContainsAny(queue, "*?[")
+}
+
 func parseQueueAndWeight(queueAndWeight string) (queue string, weight int, err error) {
 	parts := strings.SplitN(queueAndWeight, "=", 2)
 	queue = parts[0]
@@ -76,6 +76,16 @@ var queuesFlagSetTests = []struct {
 		nil,
 		errors.New("you must specify at least one queue"),
 	},
+	{
+		"high,reports_*=2,*",
+		queuesFlag([]string{"high", "reports_*", "reports_*", "*"}),
+		nil,
+	},
+	{
+		"reports_[",
+		nil,
+		errors.New("invalid queue pattern"),
+	},
 }
 
 func TestQueuesFlagSet(t *testing.T) {
@@ -0,0 +1,122 @@
+package goworker
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var sameJSONTests = []struct {
+	a, b     string
+	expected bool
+}{
+	{`["hi",1]`, `["hi",1]`, true},
+	{`[ "hi", 1 ]`, `["hi",1]`, true},
+	{`[{"a":1,"b":2}]`, `[{"b":2,"a":1}]`, true},
+	{`[12345678901234567890]`, `[12345678901234567890]`, true},
+	{`[12345678901234567890]`, `[12345678901234567891]`, false},
+	{`["hi",1]`, `[1,"hi"]`, false},
+	{`["hi"]`, `invalid`, false},
+}
+
+func TestSameJSON(t *testing.T) {
+	for _, tt := range sameJSONTests {
+		if actual := sameJSON([]byte(tt.a), []byte(tt.b)); actual != tt.expected {
+			t.Errorf("sameJSON(%s, %s): expected %v, actual %v", tt.a, tt.b, tt.expected, actual)
+		}
+	}
+}
+
+func TestQueueKey(t *testing.T) {
+	client := NewClient(WorkerSettings{Namespace: "resque:"})
+	if actual := client.queueKey("high"); actual != "resque:queue:high" {
+		t.Errorf("expected resque:queue:high, actual %s", actual)
+	}
+	if actual := client.queuePausedKey("high"); actual != "resque:pause:queue:high" {
+		t.Errorf("expected resque:pause:queue:high, actual %s", actual)
+	}
+}
+
+func TestMoveJobsSameQueue(t *testing.T) {
+	client := NewClient(WorkerSettings{})
+	if _, err := client.MoveJobs("high", "high", ""); err != errorSameQueue {
+		t.Errorf("expected %v, actual %v", errorSameQueue, err)
+	}
+}
+
+func TestClientMoveJobs(t *testing.T) {
+	client := dockerClient(WorkerSettings{QueuesString: "high"}, t)
+	defer dockerComposeStop(t)
+	defer client.Close()
+
+	conn, err := client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.PutConn(conn)
+
+	jobs := []interface{}{client.queueKey("high")}
+	for i := 0; i < 2*moveBatchSize+50; i++ {
+		jobs = append(jobs, fmt.Sprintf(`{"class":"MyClass","args":[%d]}`, i))
+	}
+	if _, err := conn.Do("RPUSH", jobs...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Do("RPUSH", client.queueKey("low"), `{"class":"OtherClass","args":[]}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.MoveJobs("high", "high", ""); err != errorSameQueue {
+		t.Errorf("expected %v, actual %v", errorSameQueue, err)
+	}
+	if size, _ := client.QueueSize("high"); size != len(jobs)-1 {
+		t.Errorf("expected moving onto the same queue to keep %d jobs, actual %d", len(jobs)-1, size)
+	}
+
+	// in batches onto an existing queue
+	moved, err := client.MoveJobs("high", "low", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != len(jobs)-1 {
+		t.Errorf("expected %d jobs to be moved, actual %d", len(jobs)-1, moved)
+	}
+	low, err := redis.Strings(conn.Do("LRANGE", client.queueKey("low"), 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(low) != len(jobs) || low[1] != jobs[1] || low[len(low)-1] != jobs[len(jobs)-1] {
+		t.Errorf("expected the jobs to be appended in order, actual %v", low)
+	}
+
+	// at once onto a new queue
+	moved, err = client.MoveJobs("low", "archive", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != len(jobs) {
+		t.Errorf("expected %d jobs to be moved, actual %d", len(jobs), moved)
+	}
+	sizes, err := client.QueueSizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes["archive"] != len(jobs) || sizes["low"] != 0 {
+		t.Errorf("expected all jobs on the archive queue, actual %v", sizes)
+	}
+
+	// by class
+	moved, err = client.MoveJobs("archive", "low", "OtherClass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, err = redis.Strings(conn.Do("LRANGE", client.queueKey("low"), 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{`{"class":"OtherClass","args":[]}`}; moved != 1 || !reflect.DeepEqual(low, expected) {
+		t.Errorf("expected %v to be moved, actual %d jobs %v", expected, moved, low)
+	}
+}
@@ -0,0 +1,393 @@
+package goworker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Every recurring job is enqueued by a single leader among
+// the goworker processes sharing a namespace which have the
+// schedule registered. The leader of a schedule holds the
+// lock
+//
+//	resque:cron:leader:<schedule>
+//
+// with a lease which it renews while it runs, and records
+// the last enqueued tick of every schedule in the hash
+// resque:cron:last. When the leader dies, another process
+// with the schedule takes over once the lease expires and
+// catches up on the ticks missed in the meantime according
+// to the catch-up policy of the schedule.
+const (
+	cronCheckInterval = time.Second
+	cronLeaseTTL      = 15 * time.Second
+	cronLeaseRenew    = cronLeaseTTL / 3
+	// a tick is missed when it is older than this
+	cronMissedAfter = time.Minute
+	// the most jobs enqueued at once by CatchUpAll
+	cronMaxCatchUp = 100
+)
+
+var (
+	errorScheduleName   = errors.New("schedule must have a unique name without whitespace")
+	errorScheduleJob    = errors.New("schedule must have a class and a queue")
+	errorInvalidCatchUp = errors.New("invalid catch-up policy, use skip, once or all")
+)
+
+// CatchUpPolicy decides what happens to the ticks of a
+// schedule missed while no process was leading, e.g. during
+// a failover or a deployment.
+type CatchUpPolicy int
+
+const (
+	// CatchUpDefault uses the CronCatchUp setting.
+	CatchUpDefault CatchUpPolicy = iota
+	// CatchUpSkip drops missed ticks.
+	CatchUpSkip
+	// CatchUpOnce enqueues a single job for all missed ticks.
+	CatchUpOnce
+	// CatchUpAll enqueues a job for every missed tick.
+	CatchUpAll
+)
+
+var catchUpPolicyNames = map[CatchUpPolicy]string{
+	CatchUpDefault: "default",
+	CatchUpSkip:    "skip",
+	CatchUpOnce:    "once",
+	CatchUpAll:     "all",
+}
+
+func (p *CatchUpPolicy) Set(value string) error {
+	for policy, name := range catchUpPolicyNames {
+		if name == value {
+			*p = policy
+			return nil
+		}
+	}
+	return errorInvalidCatchUp
+}
+
+func (p *CatchUpPolicy) String() string {
+	return catchUpPolicyNames[*p]
+}
+
+// Schedule describes a recurring job. Cron is a standard 5
+// field cron expression evaluated in the local time zone, a
+// descriptor such as @hourly, or @every followed by a
+// duration.
+type Schedule struct {
+	Name    string
+	Cron    string
+	Class   string
+	Queue   string
+	Args    []interface{}
+	CatchUp CatchUpPolicy
+
+	spec cronSchedule
+}
+
+// AddSchedule registers a recurring job with the default
+// client.
+func AddSchedule(schedule Schedule) error {
+	return defaultClient.AddSchedule(schedule)
+}
+
+// AddSchedule registers a recurring job. The job is enqueued
+// by Work on every tick of the schedule, by exactly one of
+// the processes which have the schedule registered, so
+// processes may register different schedules.
+func (c *Client) AddSchedule(schedule Schedule) error {
+	if schedule.Name == "" || strings.ContainsAny(schedule.Name, " \t\n") {
+		return errorScheduleName
+	}
+	if schedule.Class == "" || schedule.Queue == "" {
+		return errorScheduleJob
+	}
+	spec, err := parseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+	schedule.spec = spec
+	if schedule.Args == nil {
+		schedule.Args = []interface{}{}
+	}
+	c.schedules[schedule.Name] = &schedule
+	return nil
+}
+
+var (
+	cronRenewScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+	cronReleaseScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+	// cronEnqueueScript pushes the payloads of a schedule and
+	// records its last tick, but only while the caller still
+	// holds the lock, so that a deposed leader cannot enqueue
+	// a tick twice.
+	//
+	// KEYS: lock, last ticks hash, queue, queues set. ARGV:
+	// token, schedule name, tick timestamp, queue name,
+	// payloads.
+	cronEnqueueScript = redis.NewScript(4, `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return -1
+end
+if #ARGV > 4 then
+	redis.call('SADD', KEYS[4], ARGV[4])
+end
+for i = 5, #ARGV do
+	redis.call('RPUSH', KEYS[3], ARGV[i])
+end
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+return #ARGV - 4
+`)
+)
+
+func (c *Client) cronLockKey(name string) string {
+	return fmt.Sprintf("%scron:leader:%s", c.Namespace(), name)
+}
+
+// cron leads the schedules of the client while it can until
+// quit is closed.
+func (c *Client) cron(quit <-chan bool) {
+	hostname, _ := os.Hostname()
+	token := fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), rand.Int63())
+
+	names := make([]string, 0, len(c.schedules))
+	for name := range c.schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// renewed holds when the lease of every schedule led by
+	// the process was last renewed
+	renewed := make(map[string]time.Time)
+
+	defer func() {
+		if len(renewed) == 0 {
+			return
+		}
+		conn, err := c.GetConn()
+		if err != nil {
+			c.logger.Error("Error on getting connection to release cron locks", "error", err)
+			return
+		}
+		defer c.PutConn(conn)
+		for name := range renewed {
+			if _, err := cronReleaseScript.Do(conn.Conn, c.cronLockKey(name), token); err != nil {
+				c.logger.Error("Error releasing cron lock", "schedule", name, "error", err)
+			}
+		}
+	}()
+
+	for {
+		conn, err := c.GetConn()
+		if err != nil {
+			c.logger.Error("Error on getting connection in cron", "error", err)
+		} else {
+			now := time.Now()
+			for _, name := range names {
+				if !c.leadSchedule(conn, name, token, renewed, now) {
+					continue
+				}
+				if err := c.enqueueRecurring(conn, c.schedules[name], token, now); err != nil {
+					c.logger.Error("Error enqueueing recurring jobs", "schedule", name, "error", err)
+				}
+			}
+			c.PutConn(conn)
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(cronCheckInterval):
+		}
+	}
+}
+
+// leadSchedule acquires or renews the lock of the schedule
+// and tells whether the process leads it.
+func (c *Client) leadSchedule(conn *RedisConn, name, token string, renewed map[string]time.Time, now time.Time) bool {
+	lock := c.cronLockKey(name)
+	last, leader := renewed[name]
+	if !leader {
+		reply, err := conn.Do("SET", lock, token, "NX", "PX", int64(cronLeaseTTL/time.Millisecond))
+		if err != nil {
+			c.logger.Error("Error acquiring cron lock", "schedule", name, "error", err)
+			return false
+		}
+		if reply == nil {
+			return false
+		}
+		c.logger.Info("Leading recurring job", "schedule", name, "token", token)
+		renewed[name] = now
+		return true
+	}
+	if now.Sub(last) < cronLeaseRenew {
+		return true
+	}
+
+	held, err := redis.Int(cronRenewScript.Do(conn.Conn, lock, token, int64(cronLeaseTTL/time.Millisecond)))
+	if err != nil {
+		c.logger.Error("Error renewing cron lock", "schedule", name, "error", err)
+		return true
+	}
+	if held == 0 {
+		c.logger.Warn("Lost the lead of recurring job", "schedule", name, "token", token)
+		delete(renewed, name)
+		return false
+	}
+	renewed[name] = now
+	return true
+}
+
+// enqueueRecurring enqueues the jobs of the ticks of the
+// schedule which passed since its last tick.
+func (c *Client) enqueueRecurring(conn *RedisConn, schedule *Schedule, token string, now time.Time) error {
+	lock := c.cronLockKey(schedule.Name)
+	lastTicks := fmt.Sprintf("%scron:last", c.Namespace())
+	name := schedule.Name
+
+	last, err := redis.Int64(conn.Do("HGET", lastTicks, name))
+	if err == redis.ErrNil {
+		// a new schedule starts with the next tick
+		_, err = cronEnqueueScript.Do(conn.Conn, lock, lastTicks, "", "", token, name, now.Unix(), "")
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	ticks, tick := passedTicks(schedule.spec, time.Unix(last, 0), now, cronMaxCatchUp)
+	if ticks == 0 {
+		return nil
+	}
+
+	count := c.catchUp(schedule, ticks, now.Sub(tick))
+	if count < ticks {
+		c.logger.Warn("Schedule missed ticks", "schedule", name, "missed", ticks, "enqueued", count)
+	}
+
+	payload, err := json.Marshal(Payload{Class: schedule.Class, Args: schedule.Args})
+	if err != nil {
+		return err
+	}
+	args := []interface{}{
+		lock,
+		lastTicks,
+		c.queueKey(schedule.Queue),
+		c.queuesKey(),
+		token,
+		name,
+		tick.Unix(),
+		schedule.Queue,
+	}
+	for i := 0; i < count; i++ {
+		args = append(args, payload)
+	}
+
+	enqueued, err := redis.Int(cronEnqueueScript.Do(conn.Conn, args...))
+	if err != nil {
+		return err
+	}
+	if enqueued < 0 {
+		return fmt.Errorf("lost the lead of recurring job %s before enqueueing it", name)
+	}
+	c.logger.Debug("Enqueued recurring jobs", "schedule", name, "enqueued", enqueued)
+	return nil
+}
+
+// passedTicks returns how many ticks of the schedule passed
+// after last up to now, and the latest of them. It counts
+// at most limit+1 ticks, beyond which it jumps straight to
+// the latest tick, so that a long outage of a frequent
+// schedule does not walk through every missed tick.
+func passedTicks(spec cronSchedule, last, now time.Time, limit int) (int, time.Time) {
+	ticks := 0
+	tick := last
+	for next := spec.next(tick); !next.IsZero() && !next.After(now); next = spec.next(next) {
+		tick = next
+		ticks++
+		if ticks > limit {
+			return ticks, latestTick(spec, tick, now)
+		}
+	}
+	return ticks, tick
+}
+
+// latestTick returns the latest tick of the schedule up to
+// now, given a tick after which to look. It looks back from
+// now over growing windows and only walks the ticks within
+// the first window which has any.
+func latestTick(spec cronSchedule, after, now time.Time) time.Time {
+	for _, window := range []time.Duration{
+		time.Minute,
+		time.Hour,
+		24 * time.Hour,
+		32 * 24 * time.Hour,
+		366 * 24 * time.Hour,
+	} {
+		from := now.Add(-window)
+		if from.Before(after) {
+			from = after
+		}
+		next := spec.next(from)
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		latest := next
+		for next = spec.next(next); !next.IsZero() && !next.After(now); next = spec.next(next) {
+			latest = next
+		}
+		return latest
+	}
+
+	// a tick further back, such as February 29, is walked to
+	latest := after
+	for next := spec.next(after); !next.IsZero() && !next.After(now); next = spec.next(next) {
+		latest = next
+	}
+	return latest
+}
+
+// catchUp returns how many jobs to enqueue for the given
+// number of passed ticks, the latest of which is age old.
+func (c *Client) catchUp(schedule *Schedule, ticks int, age time.Duration) int {
+	policy := schedule.CatchUp
+	if policy == CatchUpDefault {
+		policy = c.settings.CronCatchUp
+	}
+
+	switch policy {
+	case CatchUpAll:
+		if ticks > cronMaxCatchUp {
+			return cronMaxCatchUp
+		}
+		return ticks
+	case CatchUpOnce:
+		return 1
+	default:
+		if age > cronMissedAfter {
+			return 0
+		}
+		return 1
+	}
+}
@@ -0,0 +1,174 @@
+package goworker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/gomodule/redigo/redis"
+)
+
+var catchUpPolicySetTests = []struct {
+	v        string
+	expected CatchUpPolicy
+	err      error
+}{
+	{"skip", CatchUpSkip, nil},
+	{"once", CatchUpOnce, nil},
+	{"all", CatchUpAll, nil},
+	{"never", CatchUpDefault, errorInvalidCatchUp},
+	{"", CatchUpDefault, errorInvalidCatchUp},
+}
+
+func TestCatchUpPolicySet(t *testing.T) {
+	for _, tt := range catchUpPolicySetTests {
+		var actual CatchUpPolicy
+		err := actual.Set(tt.v)
+		if actual != tt.expected || err != tt.err {
+			t.Errorf("CatchUpPolicy: set to %q expected %v (%v), actual %v (%v)", tt.v, tt.expected, tt.err, actual, err)
+		}
+		if err == nil && actual.String() != tt.v {
+			t.Errorf("CatchUpPolicy(%q): String returned %q", tt.v, actual.String())
+		}
+	}
+}
+
+var catchUpTests = []struct {
+	schedule CatchUpPolicy
+	setting  CatchUpPolicy
+	ticks    int
+	age      time.Duration
+	expected int
+}{
+	{CatchUpDefault, CatchUpDefault, 1, time.Second, 1},
+	{CatchUpDefault, CatchUpDefault, 1, time.Hour, 0},
+	{CatchUpSkip, CatchUpAll, 5, time.Second, 1},
+	{CatchUpSkip, CatchUpAll, 5, time.Hour, 0},
+	{CatchUpDefault, CatchUpOnce, 5, time.Hour, 1},
+	{CatchUpOnce, CatchUpSkip, 5, time.Hour, 1},
+	{CatchUpAll, CatchUpSkip, 5, time.Hour, 5},
+	{CatchUpDefault, CatchUpAll, 1000, time.Hour, cronMaxCatchUp},
+}
+
+func TestCatchUp(t *testing.T) {
+	for _, tt := range catchUpTests {
+		client := NewClient(WorkerSettings{CronCatchUp: tt.setting})
+		actual := client.catchUp(&Schedule{CatchUp: tt.schedule}, tt.ticks, tt.age)
+		if actual != tt.expected {
+			t.Errorf("catchUp(%v, %v, %d, %v): expected %d, actual %d", tt.schedule, tt.setting, tt.ticks, tt.age, tt.expected, actual)
+		}
+	}
+}
+
+func TestPassedTicks(t *testing.T) {
+	now := time.Date(2017, 3, 25, 10, 15, 30, 0, time.UTC)
+	for _, tt := range []struct {
+		spec     string
+		last     time.Time
+		ticks    int
+		expected time.Time
+	}{
+		{"@every 1s", now.Add(-3 * time.Second), 3, now},
+		{"@every 1s", now.AddDate(-1, 0, 0), cronMaxCatchUp + 1, now},
+		{"* * * * *", now.AddDate(-1, 0, 0), cronMaxCatchUp + 1, time.Date(2017, 3, 25, 10, 15, 0, 0, time.UTC)},
+		{"0 3 * * *", now.AddDate(0, 0, -2), 2, time.Date(2017, 3, 25, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * *", now.Add(-time.Hour), 0, now.Add(-time.Hour)},
+	} {
+		spec, err := parseCron(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ticks, tick := passedTicks(spec, tt.last, now, cronMaxCatchUp)
+		if ticks != tt.ticks || !tick.Equal(tt.expected) {
+			t.Errorf("%q since %v: expected %d ticks up to %v, actual %d up to %v", tt.spec, tt.last, tt.ticks, tt.expected, ticks, tick)
+		}
+	}
+}
+
+var addScheduleTests = []struct {
+	schedule Schedule
+	err      bool
+}{
+	{Schedule{Name: "report", Cron: "0 3 * * *", Class: "Report", Queue: "reports"}, false},
+	{Schedule{Name: "ping", Cron: "@every 30s", Class: "Ping", Queue: "pings"}, false},
+	{Schedule{Name: "", Cron: "0 3 * * *", Class: "Report", Queue: "reports"}, true},
+	{Schedule{Name: "nightly report", Cron: "0 3 * * *", Class: "Report", Queue: "reports"}, true},
+	{Schedule{Name: "report", Cron: "0 3 * * *", Queue: "reports"}, true},
+	{Schedule{Name: "report", Cron: "0 3 * * *", Class: "Report"}, true},
+	{Schedule{Name: "report", Cron: "0 25 * * *", Class: "Report", Queue: "reports"}, true},
+}
+
+func TestAddSchedule(t *testing.T) {
+	for _, tt := range addScheduleTests {
+		client := NewClient(WorkerSettings{})
+		err := client.AddSchedule(tt.schedule)
+		if (err != nil) != tt.err {
+			t.Errorf("AddSchedule(%+v): expected error %v, actual %v", tt.schedule, tt.err, err)
+		}
+		if err == nil && client.schedules[tt.schedule.Name].spec == nil {
+			t.Errorf("AddSchedule(%+v): cron not parsed", tt.schedule)
+		}
+	}
+}
+
+func TestClientLeadSchedules(t *testing.T) {
+	first := dockerClient(WorkerSettings{QueuesString: "high"}, t)
+	defer dockerComposeStop(t)
+	defer first.Close()
+	second := NewClient(WorkerSettings{
+		URI:          first.settings.URI,
+		QueuesString: "high",
+		UseNumber:    true,
+		Logger:       SeelogLogger(seelog.Disabled),
+	})
+	if err := second.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	for _, schedule := range []struct {
+		client *Client
+		name   string
+	}{
+		{first, "shared"},
+		{second, "shared"},
+		{second, "second"},
+	} {
+		if err := schedule.client.AddSchedule(Schedule{Name: schedule.name, Cron: "* * * * *", Class: "MyClass", Queue: "high"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := first.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.PutConn(conn)
+
+	now := time.Now()
+	firstLeads, secondLeads := map[string]time.Time{}, map[string]time.Time{}
+	if !first.leadSchedule(conn, "shared", "first", firstLeads, now) {
+		t.Error("expected the first process to lead the shared schedule")
+	}
+	if second.leadSchedule(conn, "shared", "second", secondLeads, now) {
+		t.Error("expected the second process not to lead the shared schedule")
+	}
+	if !second.leadSchedule(conn, "second", "second", secondLeads, now) {
+		t.Error("expected the second process to lead its own schedule")
+	}
+
+	last := now.Truncate(time.Minute).Add(-time.Minute).Unix()
+	if _, err := conn.Do("HSET", fmt.Sprintf("%scron:last", first.Namespace()), "shared", last, "second", last); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.enqueueRecurring(conn, second.schedules["shared"], "second", now); err == nil {
+		t.Error("expected a process which does not lead a schedule not to enqueue it")
+	}
+	if err := second.enqueueRecurring(conn, second.schedules["second"], "second", now); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := redis.Int(conn.Do("LLEN", first.queueKey("high"))); size != 1 {
+		t.Errorf("expected the schedule of the second process to be enqueued once, actual %d jobs", size)
+	}
+}
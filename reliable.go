@@ -0,0 +1,244 @@
+package goworker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// In reliable mode, the poller atomically moves every job
+// it fetches into an in-flight list owned by the process,
+//
+//	resque:inflight:<hostname>:<process-id>:<token>:<queue>
+//
+// and the worker removes it from there only after it has
+// recorded the outcome of the job. The token is drawn anew
+// every time Work starts, so that a restarted container
+// which gets the same hostname and process id does not take
+// over the lists of its previous run. The in-flight lists
+// are registered in the resque:inflight set and every
+// process holds a lease under
+// resque:inflight:<hostname>:<process-id>:<token> while it
+// runs. When a process starts, it moves the jobs of
+// in-flight lists without a lease back to the head of their
+// queues.
+const (
+	inflightLeaseTTL   = 30 * time.Second
+	inflightLeaseRenew = inflightLeaseTTL / 3
+)
+
+var errorInvalidInflightMember = errors.New("invalid in-flight list registration")
+
+func (c *Client) inflightSetKey() string {
+	return fmt.Sprintf("%sinflight", c.Namespace())
+}
+
+// newInflightToken returns the token which tells the
+// in-flight lists of a run of Work apart from those of the
+// previous runs of a process with the same id.
+func newInflightToken() string {
+	return strconv.FormatInt(rand.Int63(), 36)
+}
+
+func (c *Client) inflightLeaseKey(hostname string, pid int, token string) string {
+	return fmt.Sprintf("%sinflight:%s:%d:%s", c.Namespace(), hostname, pid, token)
+}
+
+func (c *Client) inflightListKey(hostname string, pid int, token, queue string) string {
+	return fmt.Sprintf("%sinflight:%s:%d:%s:%s", c.Namespace(), hostname, pid, token, queue)
+}
+
+func inflightMember(hostname string, pid int, token, queue string) string {
+	return fmt.Sprintf("%s:%d:%s:%s", hostname, pid, token, queue)
+}
+
+func parseInflightMember(member string) (hostname string, pid int, token, queue string, err error) {
+	parts := strings.SplitN(member, ":", 4)
+	if len(parts) != 4 || parts[0] == "" || parts[2] == "" || parts[3] == "" {
+		return "", 0, "", "", errorInvalidInflightMember
+	}
+	pid, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, "", "", errorInvalidInflightMember
+	}
+	return parts[0], pid, parts[2], parts[3], nil
+}
+
+// distinctQueues returns the active queues of the process
+// without the repetitions introduced by weights.
+func (p *process) distinctQueues() []string {
+	active := p.activeQueues()
+	seen := make(map[string]bool, len(active))
+	queues := []string{}
+	for _, queue := range active {
+		if !seen[queue] {
+			seen[queue] = true
+			queues = append(queues, queue)
+		}
+	}
+	return queues
+}
+
+func (p *process) inflightKey(queue string) string {
+	return p.client.inflightListKey(p.Hostname, p.Pid, p.client.inflightToken, queue)
+}
+
+// fetch atomically moves the oldest job of the queue into
+// the in-flight list of the process.
+func (p *process) fetch(conn *RedisConn, queue string) (interface{}, error) {
+	return conn.Do(
+		"LMOVE",
+		fmt.Sprintf("%squeue:%s", p.client.Namespace(), queue),
+		p.inflightKey(queue),
+		"LEFT",
+		"RIGHT",
+	)
+}
+
+// ack removes a finished job from the in-flight list. The
+// command is only sent, the caller flushes it.
+func (p *process) ack(conn *RedisConn, job *Job) error {
+	if job.raw == nil {
+		return nil
+	}
+	return conn.Send("LREM", p.inflightKey(job.Queue), 1, job.raw)
+}
+
+// requeue pushes a fetched job back to the head of its
+// queue. In reliable mode, the job is moved there from the
+// in-flight list of the process.
+func (p *process) requeue(conn *RedisConn, job *Job) error {
+	queue := fmt.Sprintf("%squeue:%s", p.client.Namespace(), job.Queue)
+	if job.raw == nil {
+		buf, err := json.Marshal(job.Payload)
+		if err != nil {
+			return err
+		}
+		_, err = conn.Do("LPUSH", queue, buf)
+		return err
+	}
+
+	conn.Send("MULTI")
+	conn.Send("LREM", p.inflightKey(job.Queue), 1, job.raw)
+	conn.Send("LPUSH", queue, job.raw)
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+// registerInflight records the in-flight lists of the
+// process and takes the lease on them.
+func (p *process) registerInflight(conn *RedisConn) error {
+	for _, queue := range p.distinctQueues() {
+		conn.Send("SADD", p.client.inflightSetKey(), inflightMember(p.Hostname, p.Pid, p.client.inflightToken, queue))
+	}
+	return p.renewInflight(conn)
+}
+
+func (p *process) renewInflight(conn *RedisConn) error {
+	_, err := conn.Do("SET", p.client.inflightLeaseKey(p.Hostname, p.Pid, p.client.inflightToken), time.Now().String(), "EX", int(inflightLeaseTTL/time.Second))
+	return err
+}
+
+// holdInflight renews the lease of the process until the
+// returned function is called.
+func (p *process) holdInflight() func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(inflightLeaseRenew)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				conn, err := p.client.GetConn()
+				if err != nil {
+					p.client.logger.Error("Error on getting connection to renew in-flight lease", p.fields("error", err)...)
+					continue
+				}
+				if err := p.renewInflight(conn); err != nil {
+					p.client.logger.Error("Error renewing in-flight lease", p.fields("error", err)...)
+				}
+				p.client.PutConn(conn)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// releaseInflight unregisters the empty in-flight lists of
+// the process and drops its lease. Lists which still hold
+// jobs stay registered and are recovered on the next start.
+func (p *process) releaseInflight(conn *RedisConn) error {
+	released := true
+	for _, queue := range p.distinctQueues() {
+		length, err := redis.Int(conn.Do("LLEN", p.inflightKey(queue)))
+		if err != nil {
+			return err
+		}
+		if length > 0 {
+			p.client.logger.Warn("Jobs left in flight", p.fields("queue", queue, "jobs", length)...)
+			released = false
+			continue
+		}
+		conn.Send("SREM", p.client.inflightSetKey(), inflightMember(p.Hostname, p.Pid, p.client.inflightToken, queue))
+	}
+	if released {
+		conn.Send("DEL", p.client.inflightLeaseKey(p.Hostname, p.Pid, p.client.inflightToken))
+	}
+	return conn.Flush()
+}
+
+// recoverInflight moves the jobs of in-flight lists whose
+// process lost its lease back to the head of their queues.
+func (c *Client) recoverInflight(conn *RedisConn) error {
+	members, err := redis.Strings(conn.Do("SMEMBERS", c.inflightSetKey()))
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		hostname, pid, token, queue, err := parseInflightMember(member)
+		if err != nil {
+			c.logger.Error("Skipping in-flight list", "list", member, "error", err)
+			continue
+		}
+
+		alive, err := redis.Bool(conn.Do("EXISTS", c.inflightLeaseKey(hostname, pid, token)))
+		if err != nil {
+			return err
+		}
+		if alive {
+			continue
+		}
+
+		list := c.inflightListKey(hostname, pid, token, queue)
+		requeued := 0
+		for {
+			// moving from the tail to the head keeps the original order
+			reply, err := conn.Do("LMOVE", list, fmt.Sprintf("%squeue:%s", c.Namespace(), queue), "RIGHT", "LEFT")
+			if err != nil {
+				return err
+			}
+			if reply == nil {
+				break
+			}
+			requeued++
+		}
+		if requeued > 0 {
+			c.logger.Info("Requeued jobs left in flight", "queue", queue, "host", hostname, "pid", pid, "jobs", requeued)
+		}
+
+		if _, err := conn.Do("SREM", c.inflightSetKey(), member); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package goworker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var parseInflightMemberTests = []struct {
+	member   string
+	hostname string
+	pid      int
+	token    string
+	queue    string
+	err      error
+}{
+	{"hostname:12345:k3x9:high", "hostname", 12345, "k3x9", "high", nil},
+	{"hostname:12345:k3x9:tenant:reports", "hostname", 12345, "k3x9", "tenant:reports", nil},
+	{"hostname:12345:k3x9:", "", 0, "", "", errorInvalidInflightMember},
+	{"hostname:12345::high", "", 0, "", "", errorInvalidInflightMember},
+	{"hostname:12345:high", "", 0, "", "", errorInvalidInflightMember},
+	{"hostname:pid:k3x9:high", "", 0, "", "", errorInvalidInflightMember},
+	{"hostname", "", 0, "", "", errorInvalidInflightMember},
+}
+
+func TestParseInflightMember(t *testing.T) {
+	for _, tt := range parseInflightMemberTests {
+		hostname, pid, token, queue, err := parseInflightMember(tt.member)
+		if err != tt.err {
+			t.Errorf("parseInflightMember(%q): expected error %v, actual %v", tt.member, tt.err, err)
+			continue
+		}
+		if hostname != tt.hostname || pid != tt.pid || token != tt.token || queue != tt.queue {
+			t.Errorf("parseInflightMember(%q): expected %s %d %s %s, actual %s %d %s %s", tt.member, tt.hostname, tt.pid, tt.token, tt.queue, hostname, pid, token, queue)
+		}
+	}
+}
+
+func TestInflightMemberRoundTrip(t *testing.T) {
+	token := newInflightToken()
+	member := inflightMember("hostname", 12345, token, "high")
+	hostname, pid, actualToken, queue, err := parseInflightMember(member)
+	if err != nil || hostname != "hostname" || pid != 12345 || actualToken != token || queue != "high" {
+		t.Errorf("round trip of %q: got %s %d %s %s %v", member, hostname, pid, actualToken, queue, err)
+	}
+}
+
+func TestNewInflightToken(t *testing.T) {
+	if newInflightToken() == newInflightToken() {
+		t.Error("expected the tokens of two runs to differ")
+	}
+}
+
+func TestProcessDistinctQueues(t *testing.T) {
+	p := process{Queues: []string{"high", "high", "low", "high"}}
+	actual := p.distinctQueues()
+	if len(actual) != 2 || actual[0] != "high" || actual[1] != "low" {
+		t.Errorf("expected [high low], actual %v", actual)
+	}
+}
+
+func TestReliableInflight(t *testing.T) {
+	client := dockerClient(WorkerSettings{QueuesString: "high", Reliable: true}, t)
+	defer dockerComposeStop(t)
+	defer client.Close()
+	client.inflightToken = newInflightToken()
+
+	p, err := newPoller(client, []string{"high"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.PutConn(conn)
+
+	first := `{"class":"MyClass","args":[1]}`
+	second := `{"class":"MyClass","args":[2]}`
+	if _, err := conn.Do("RPUSH", client.queueKey("high"), first, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.registerInflight(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := p.getJobFrom(conn, []string{"high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || string(job.raw) != first {
+		t.Fatalf("expected the first job, actual %#v", job)
+	}
+	if err := client.recoverInflight(conn); err != nil {
+		t.Fatal(err)
+	}
+	if inflight, _ := redis.Strings(conn.Do("LRANGE", p.inflightKey("high"), 0, -1)); !reflect.DeepEqual(inflight, []string{first}) {
+		t.Errorf("expected the job to stay in flight while the lease is held, actual %v", inflight)
+	}
+
+	p.ack(conn, job)
+	if _, err := conn.Do(""); err != nil {
+		t.Fatal(err)
+	}
+	if length, _ := redis.Int(conn.Do("LLEN", p.inflightKey("high"))); length != 0 {
+		t.Errorf("expected the acknowledged job to leave the in-flight list, actual %d jobs", length)
+	}
+
+	if _, err := p.getJobFrom(conn, []string{"high"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Do("DEL", client.inflightLeaseKey(p.Hostname, p.Pid, client.inflightToken)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.recoverInflight(conn); err != nil {
+		t.Fatal(err)
+	}
+	if queue, _ := redis.Strings(conn.Do("LRANGE", client.queueKey("high"), 0, -1)); !reflect.DeepEqual(queue, []string{second}) {
+		t.Errorf("expected the job of the lost lease to be requeued, actual %v", queue)
+	}
+	if members, _ := redis.Strings(conn.Do("SMEMBERS", client.inflightSetKey())); len(members) != 0 {
+		t.Errorf("expected the recovered list to be unregistered, actual %v", members)
+	}
+}
+
+func TestReliableInvalidPayload(t *testing.T) {
+	client := dockerClient(WorkerSettings{QueuesString: "high", Reliable: true}, t)
+	defer dockerComposeStop(t)
+	defer client.Close()
+	client.inflightToken = newInflightToken()
+
+	p, err := newPoller(client, []string{"high"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := `{"class":`
+	valid := `{"class":"MyClass","args":[]}`
+	_, err = conn.Do("RPUSH", client.queueKey("high"), invalid, valid)
+	client.PutConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quit := make(chan bool)
+	jobs := p.poll(10*time.Millisecond, quit)
+	select {
+	case job := <-jobs:
+		if job == nil || string(job.raw) != valid {
+			t.Errorf("expected the poller to go on with the valid job, actual %#v", job)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the poller to survive the invalid payload")
+	}
+	close(quit)
+	for range jobs {
+	}
+
+	failures, err := client.Failures(FailureFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || !reflect.DeepEqual(failures[0].Payload.Args, []interface{}{invalid}) || failures[0].Queue != "high" {
+		t.Errorf("expected the invalid payload to be recorded as failed, actual %#v", failures)
+	}
+
+	conn, err = client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.PutConn(conn)
+	if inflight, _ := redis.Strings(conn.Do("LRANGE", p.inflightKey("high"), 0, -1)); !reflect.DeepEqual(inflight, []string{valid}) {
+		t.Errorf("expected only the valid job in flight, actual %v", inflight)
+	}
+}
@@ -0,0 +1,229 @@
+package goworker
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Backoff returns how long to wait before the given retry.
+// The first retry has attempt 1.
+type Backoff func(attempt int) time.Duration
+
+// FixedBackoff waits the same delay before every retry.
+func FixedBackoff(delay time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		return delay
+	}
+}
+
+// ExponentialBackoff doubles the delay with every retry,
+// starting at base and never exceeding max. A zero max
+// means no limit.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		delay := time.Duration(float64(base) * math.Pow(2, float64(attempt-1)))
+		if delay < 0 || (max > 0 && delay > max) {
+			return max
+		}
+		return delay
+	}
+}
+
+// JitteredBackoff waits a random delay between zero and
+// the delay of ExponentialBackoff, which spreads the
+// retries of jobs that failed at the same time.
+func JitteredBackoff(base, max time.Duration) Backoff {
+	exponential := ExponentialBackoff(base, max)
+	return func(attempt int) time.Duration {
+		delay := exponential(attempt)
+		if delay <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+}
+
+// RetryPolicy describes how the failed jobs of a class are
+// retried. Retries are scheduled in the delayed queue of
+// resque-scheduler and the attempts are counted under the
+// key of resque-retry,
+//
+//	resque:resque-retry:<class>:<sha1 of args joined by ->
+//
+// so that Ruby workers using resque-retry see the same
+// state.
+type RetryPolicy struct {
+	// MaxAttempts is the number of retries after the first
+	// failure, like @retry_limit of resque-retry.
+	MaxAttempts int
+	// Backoff returns the delay before a retry. Nil retries
+	// immediately. Delayed retries are only enqueued by a
+	// process running with -scheduler or by a Ruby
+	// resque-scheduler.
+	Backoff Backoff
+	// RetryOn lists the errors which are retried, compared
+	// with errors.Is. Empty retries every error.
+	RetryOn []error
+	// Retryable decides whether an error is retried, when
+	// RetryOn does not suffice.
+	Retryable func(error) bool
+	// ExpireAttemptsAfter is how long the attempts of a job
+	// are kept after it starts or is scheduled for a retry,
+	// like expire_retry_key_after of resque-retry, so that
+	// jobs which never finish do not leave them behind. Zero
+	// keeps them for a day.
+	ExpireAttemptsAfter time.Duration
+}
+
+const defaultExpireAttemptsAfter = 24 * time.Hour
+
+func (p *RetryPolicy) expireAttemptsAfter() time.Duration {
+	if p.ExpireAttemptsAfter > 0 {
+		return p.ExpireAttemptsAfter
+	}
+	return defaultExpireAttemptsAfter
+}
+
+// delayedRetryClasses returns the classes whose retries are
+// scheduled in the delayed queue.
+func (c *Client) delayedRetryClasses() []string {
+	classes := []string{}
+	for class, policy := range c.retries {
+		if policy.Backoff != nil {
+			classes = append(classes, class)
+		}
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil && p.Retryable(err) {
+		return true
+	}
+	if len(p.RetryOn) == 0 {
+		return p.Retryable == nil
+	}
+	for _, target := range p.RetryOn {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRetryPolicy sets the retry policy for the jobs of the
+// class processed by the default client.
+func SetRetryPolicy(class string, policy RetryPolicy) {
+	defaultClient.SetRetryPolicy(class, policy)
+}
+
+// SetRetryPolicy sets the retry policy for the jobs of the
+// class.
+func (c *Client) SetRetryPolicy(class string, policy RetryPolicy) {
+	c.retries[class] = policy
+}
+
+// retryKey returns the key of resque-retry which counts the
+// attempts of the job. Like in Ruby, the arguments are
+// joined by dashes with Array#join and whitespace is removed
+// from the key. Use -use-number for floats to be joined
+// exactly as in Ruby.
+func (c *Client) retryKey(job *Job) string {
+	parts := []string{"resque-retry", job.Payload.Class}
+	if args := rubyJoin(job.Payload.Args, "-"); args != "" {
+		digest := sha1.Sum([]byte(args))
+		parts = append(parts, hex.EncodeToString(digest[:]))
+	}
+	key := strings.Join(strings.Fields(strings.Join(parts, ":")), "")
+	return c.Namespace() + key
+}
+
+// beginAttempt counts a new attempt of a job whose class has
+// a retry policy and records it in job.attempt, starting at
+// 1. resque-retry stores the attempts counting from 0.
+func (w *worker) beginAttempt(conn *RedisConn, job *Job) error {
+	policy, ok := w.client.retries[job.Payload.Class]
+	if !ok {
+		return nil
+	}
+	key := w.client.retryKey(job)
+	// the connection may hold the replies of commands sent
+	// before, so the reply of the transaction is read alone
+	conn.Send("MULTI")
+	conn.Send("SETNX", key, -1)
+	conn.Send("INCR", key)
+	conn.Send("EXPIRE", key, expireSeconds(policy.expireAttemptsAfter()))
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+	attempt, err := redis.Int(replies[1], nil)
+	if err != nil {
+		return err
+	}
+	job.attempt = attempt + 1
+	return nil
+}
+
+// retry schedules the failed job again if its retry policy
+// allows it. Otherwise it forgets the attempts of the job,
+// which is then recorded as failed.
+func (w *worker) retry(conn *RedisConn, job *Job, err error) bool {
+	policy, ok := w.client.retries[job.Payload.Class]
+	if !ok || job.attempt == 0 {
+		return false
+	}
+	if job.attempt > policy.MaxAttempts || !policy.retryable(err) {
+		w.forgetAttempts(conn, job)
+		return false
+	}
+
+	var delay time.Duration
+	if policy.Backoff != nil {
+		delay = policy.Backoff(job.attempt)
+	}
+	w.client.logger.Info("Retrying failed job", w.jobFields(job, "attempt", job.attempt, "delay", delay, "error", err)...)
+
+	if delay <= 0 {
+		buffer, err := json.Marshal(job.Payload)
+		if err == nil {
+			conn.Send("SADD", w.client.queuesKey(), job.Queue)
+			err = conn.Send("RPUSH", w.client.queueKey(job.Queue), buffer)
+		}
+		if err != nil {
+			w.client.logger.Error("Error retrying job", w.jobFields(job, "error", err)...)
+			return false
+		}
+		return true
+	}
+	if err := w.client.delayedPush(conn, time.Now().Add(delay), job); err != nil {
+		w.client.logger.Error("Error scheduling retry of job", w.jobFields(job, "error", err)...)
+		return false
+	}
+	// keep the attempts until the retry starts
+	conn.Send("EXPIRE", w.client.retryKey(job), expireSeconds(delay+policy.expireAttemptsAfter()))
+	return true
+}
+
+func (w *worker) forgetAttempts(conn *RedisConn, job *Job) error {
+	if job.attempt == 0 {
+		return nil
+	}
+	return conn.Send("DEL", w.client.retryKey(job))
+}
+
+// expireSeconds rounds the duration up to the whole seconds
+// of EXPIRE.
+func expireSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
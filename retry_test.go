@@ -0,0 +1,165 @@
+package goworker
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"golang.org/x/net/context"
+)
+
+func TestFixedBackoff(t *testing.T) {
+	backoff := FixedBackoff(time.Minute)
+	for attempt := 1; attempt <= 3; attempt++ {
+		if actual := backoff(attempt); actual != time.Minute {
+			t.Errorf("attempt %d: expected %v, actual %v", attempt, time.Minute, actual)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, 10*time.Second)
+	for _, tt := range []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	} {
+		if actual := backoff(tt.attempt); actual != tt.expected {
+			t.Errorf("attempt %d: expected %v, actual %v", tt.attempt, tt.expected, actual)
+		}
+	}
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	backoff := JitteredBackoff(time.Second, 10*time.Second)
+	for attempt := 1; attempt <= 10; attempt++ {
+		limit := ExponentialBackoff(time.Second, 10*time.Second)(attempt)
+		if actual := backoff(attempt); actual < 0 || actual > limit {
+			t.Errorf("attempt %d: expected at most %v, actual %v", attempt, limit, actual)
+		}
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	errorTransient := errors.New("transient")
+	errorPermanent := errors.New("permanent")
+
+	for _, tt := range []struct {
+		policy   RetryPolicy
+		err      error
+		expected bool
+	}{
+		{RetryPolicy{}, errorPermanent, true},
+		{RetryPolicy{RetryOn: []error{errorTransient}}, errorTransient, true},
+		{RetryPolicy{RetryOn: []error{errorTransient}}, errorPermanent, false},
+		{RetryPolicy{Retryable: func(err error) bool { return err == errorTransient }}, errorTransient, true},
+		{RetryPolicy{Retryable: func(err error) bool { return err == errorTransient }}, errorPermanent, false},
+	} {
+		if actual := tt.policy.retryable(tt.err); actual != tt.expected {
+			t.Errorf("%#v with %v: expected %v, actual %v", tt.policy, tt.err, tt.expected, actual)
+		}
+	}
+}
+
+func TestRetryKey(t *testing.T) {
+	client := NewClient(WorkerSettings{Namespace: "resque:"})
+	for _, tt := range []struct {
+		payload  Payload
+		expected string
+	}{
+		{
+			Payload{Class: "MyClass", Args: []interface{}{"hi", 1}},
+			"resque:resque-retry:MyClass:306dff42ee39bf63d1b93f29e058f4fb63998fcc",
+		},
+		{
+			Payload{Class: "MyClass"},
+			"resque:resque-retry:MyClass",
+		},
+		{
+			// an empty join has no identifier in Ruby either
+			Payload{Class: "MyClass", Args: []interface{}{nil}},
+			"resque:resque-retry:MyClass",
+		},
+	} {
+		if actual := client.retryKey(&Job{Payload: tt.payload}); actual != tt.expected {
+			t.Errorf("%#v: expected %s, actual %s", tt.payload, tt.expected, actual)
+		}
+	}
+}
+
+func TestClientDelayedRetryClasses(t *testing.T) {
+	client := NewClient(WorkerSettings{})
+	client.SetRetryPolicy("Immediate", RetryPolicy{MaxAttempts: 3})
+	client.SetRetryPolicy("Later", RetryPolicy{MaxAttempts: 3, Backoff: FixedBackoff(time.Minute)})
+	if actual := client.delayedRetryClasses(); len(actual) != 1 || actual[0] != "Later" {
+		t.Errorf("expected [Later], actual %v", actual)
+	}
+}
+
+func TestWorkerRecordFailuresRetry(t *testing.T) {
+	client := dockerClient(WorkerSettings{QueuesString: "high"}, t)
+	defer dockerComposeStop(t)
+	defer client.Close()
+	client.SetRetryPolicy("MyClass", RetryPolicy{MaxAttempts: 2})
+
+	w, err := newWorker(client, "1", []string{"high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("failed")
+	handler := w.recordFailures(func(ctx context.Context, job *Job) error {
+		return failed
+	})
+
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass", Args: []interface{}{"hi"}}}
+	for attempt := 1; attempt <= 3; attempt++ {
+		handler(context.Background(), job)
+		if job.attempt != attempt {
+			t.Fatalf("expected attempt %d, actual %d", attempt, job.attempt)
+		}
+
+		conn, err := client.GetConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := redis.Bytes(conn.Do("LPOP", client.queueKey("high")))
+		client.PutConn(conn)
+		if attempt == 3 {
+			if err != redis.ErrNil {
+				t.Errorf("expected the last attempt not to be retried, actual %s %v", payload, err)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("expected attempt %d to be retried, actual %v", attempt, err)
+		}
+		job = &Job{Queue: "high"}
+		if err := json.Unmarshal(payload, &job.Payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failures, err := client.Failures(FailureFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Error != "failed" {
+		t.Errorf("expected only the last attempt to be recorded as failed, actual %#v", failures)
+	}
+	conn, err := client.GetConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.PutConn(conn)
+	if exists, _ := redis.Bool(conn.Do("EXISTS", client.retryKey(job))); exists {
+		t.Error("expected the attempts to be forgotten after the last attempt")
+	}
+}
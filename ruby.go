@@ -0,0 +1,181 @@
+package goworker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rubyJoin joins the decoded JSON values the way Ruby's
+// Array#join does: nested arrays are flattened and joined
+// by the same separator, other values are converted with
+// to_s.
+func rubyJoin(values []interface{}, separator string) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		if array, ok := value.([]interface{}); ok {
+			parts[i] = rubyJoin(array, separator)
+		} else {
+			parts[i] = rubyString(value)
+		}
+	}
+	return strings.Join(parts, separator)
+}
+
+// rubyString returns what to_s returns in Ruby for the value
+// parsed from the same JSON.
+func rubyString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	}
+	return rubyInspect(value)
+}
+
+// rubyInspect returns what inspect returns in Ruby for the
+// value parsed from the same JSON. Hashes are written in the
+// format of Ruby before 3.4 and, since Go maps are not
+// ordered, with their keys sorted.
+func rubyInspect(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(value)
+	case string:
+		return rubyInspectString(value)
+	case json.Number:
+		// Ruby parses numbers without a fraction or an
+		// exponent as integers
+		if !strings.ContainsAny(string(value), ".eE") {
+			return string(value)
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return string(value)
+		}
+		return rubyFloat(f)
+	case float64:
+		// without json.Number, integers cannot be told apart
+		// from floats, so whole numbers are taken as integers
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return strconv.FormatInt(int64(value), 10)
+		}
+		return rubyFloat(value)
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case []interface{}:
+		parts := make([]string, len(value))
+		for i, element := range value {
+			parts[i] = rubyInspect(element)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			parts[i] = rubyInspectString(key) + "=>" + rubyInspect(value[key])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return fmt.Sprint(value)
+}
+
+// rubyFloat formats the float like Float#to_s in Ruby, which
+// uses the shortest representation and switches to the
+// exponent form below 1e-4 and from 1e16 on.
+func rubyFloat(f float64) string {
+	if f == 0 {
+		if math.Signbit(f) {
+			return "-0.0"
+		}
+		return "0.0"
+	}
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+
+	// d.dddde±XX, the digits without the point and the position
+	// of the point after the first of them
+	formatted := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exponent := formatted, 0
+	if i := strings.IndexByte(formatted, 'e'); i >= 0 {
+		mantissa = formatted[:i]
+		exponent, _ = strconv.Atoi(formatted[i+1:])
+	}
+	digits := strings.Replace(mantissa, ".", "", 1)
+	point := exponent + 1
+
+	switch {
+	case point > 16 || point < -3:
+		fraction := digits[1:]
+		if fraction == "" {
+			fraction = "0"
+		}
+		return fmt.Sprintf("%s%s.%se%+03d", sign, digits[:1], fraction, exponent)
+	case point <= 0:
+		return sign + "0." + strings.Repeat("0", -point) + digits
+	case point >= len(digits):
+		return sign + digits + strings.Repeat("0", point-len(digits)) + ".0"
+	}
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// rubyInspectString quotes the string like String#inspect in
+// Ruby.
+func rubyInspectString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\v':
+			b.WriteString(`\v`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\a':
+			b.WriteString(`\a`)
+		case 0x1b:
+			b.WriteString(`\e`)
+		case '#':
+			// #{, #$ and #@ would interpolate
+			if i+1 < len(s) && strings.IndexByte("{$@", s[i+1]) >= 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else if r == 0x7f {
+				b.WriteString(`\x7F`)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
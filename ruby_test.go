@@ -0,0 +1,40 @@
+package goworker
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRubyJoin(t *testing.T) {
+	for _, tt := range []struct {
+		args     string
+		expected string
+	}{
+		{`["hi",1]`, "hi-1"},
+		{`[[1,[2,"a"]],3]`, "1-2-a-3"},
+		{`[null,true,false]`, "-true-false"},
+		{`[1.5,1e6,1.0,-2.5]`, "1.5-1000000.0-1.0--2.5"},
+		{`[1e16,1e15,0.0001,0.00001,123.456,0.0]`, "1.0e+16-1000000000000000.0-0.0001-1.0e-05-123.456-0.0"},
+		{`[12345678901234567890]`, "12345678901234567890"},
+		{`[{"b":1,"a":"x\"y"}]`, `{"a"=>"x\"y", "b"=>1}`},
+		{`[{"a":[1,null,"#{x}"]}]`, `{"a"=>[1, nil, "\#{x}"]}`},
+	} {
+		var args []interface{}
+		decoder := json.NewDecoder(strings.NewReader(tt.args))
+		decoder.UseNumber()
+		if err := decoder.Decode(&args); err != nil {
+			t.Fatal(err)
+		}
+		if actual := rubyJoin(args, "-"); actual != tt.expected {
+			t.Errorf("%s: expected %s, actual %s", tt.args, tt.expected, actual)
+		}
+	}
+}
+
+func TestRubyJoinFloats(t *testing.T) {
+	// without json.Number whole numbers are taken as integers
+	if actual := rubyJoin([]interface{}{float64(1000000), 0.5}, "-"); actual != "1000000-0.5" {
+		t.Errorf("expected 1000000-0.5, actual %s", actual)
+	}
+}
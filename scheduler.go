@@ -0,0 +1,199 @@
+package goworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const defaultSchedulerInterval = 5 * time.Second
+
+var errorInvalidDelayedItem = errors.New("delayed job without a class or a queue")
+
+// enqueueDelayedScript moves the first item of a delayed
+// list onto its queue, provided it is still the item the
+// scheduler decoded, and removes the timestamp from the
+// schedule once its list is empty. Several schedulers may
+// therefore run at the same time without enqueueing an item
+// twice.
+//
+// KEYS: delayed list, schedule, timestamps set of the item,
+// queue, queues set. ARGV: timestamp, item, payload, delayed
+// list name without the namespace, queue name.
+var enqueueDelayedScript = redis.NewScript(5, `
+local moved = 0
+if ARGV[2] ~= '' and redis.call('LINDEX', KEYS[1], 0) == ARGV[2] then
+	redis.call('LPOP', KEYS[1])
+	redis.call('SREM', KEYS[3], ARGV[4])
+	redis.call('SADD', KEYS[5], ARGV[5])
+	redis.call('RPUSH', KEYS[4], ARGV[3])
+	moved = 1
+end
+if redis.call('LLEN', KEYS[1]) == 0 then
+	redis.call('DEL', KEYS[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+end
+return moved
+`)
+
+// EnqueueAt schedules the job to be pushed onto its queue at
+// the given time, through the default client.
+func EnqueueAt(at time.Time, job *Job) error {
+	return defaultClient.EnqueueAt(at, job)
+}
+
+// EnqueueIn schedules the job to be pushed onto its queue
+// after the given delay, through the default client.
+func EnqueueIn(delay time.Duration, job *Job) error {
+	return defaultClient.EnqueueIn(delay, job)
+}
+
+// EnqueueAt schedules the job to be pushed onto its queue at
+// the given time. The job is stored in the delayed queue of
+// resque-scheduler, so either a Ruby resque-scheduler or a
+// goworker process with the scheduler enabled enqueues it.
+func (c *Client) EnqueueAt(at time.Time, job *Job) error {
+	err := c.Init()
+	if err != nil {
+		return err
+	}
+
+	conn, err := c.GetConn()
+	if err != nil {
+		c.logger.Error("Error on getting connection on enqueue", jobFields(job, "error", err)...)
+		return err
+	}
+	defer c.PutConn(conn)
+
+	if err := c.delayedPush(conn, at, job); err != nil {
+		c.logger.Error("Cant schedule job on enqueue", jobFields(job, "error", err)...)
+		return err
+	}
+	_, err = conn.Do("")
+	return err
+}
+
+// EnqueueIn schedules the job to be pushed onto its queue
+// after the given delay.
+func (c *Client) EnqueueIn(delay time.Duration, job *Job) error {
+	return c.EnqueueAt(time.Now().Add(delay), job)
+}
+
+// schedule enqueues the due delayed jobs every interval
+// until quit is closed.
+func (c *Client) schedule(interval time.Duration, quit <-chan bool) {
+	if interval <= 0 {
+		interval = defaultSchedulerInterval
+	}
+	for {
+		conn, err := c.GetConn()
+		if err != nil {
+			c.logger.Error("Error on getting connection in scheduler", "error", err)
+		} else {
+			if _, err := c.enqueueDelayed(conn, time.Now()); err != nil {
+				c.logger.Error("Error enqueueing delayed jobs", "error", err)
+			}
+			c.PutConn(conn)
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// enqueueDelayed pushes the delayed jobs scheduled up to now
+// onto their queues, in the order of their timestamps, and
+// returns how many it has pushed.
+func (c *Client) enqueueDelayed(conn *RedisConn, now time.Time) (int, error) {
+	schedule := fmt.Sprintf("%sdelayed_queue_schedule", c.Namespace())
+	enqueued := 0
+
+	for {
+		timestamps, err := redis.Strings(conn.Do("ZRANGEBYSCORE", schedule, "-inf", now.Unix(), "LIMIT", 0, 1))
+		if err != nil {
+			return enqueued, err
+		}
+		if len(timestamps) == 0 {
+			return enqueued, nil
+		}
+		timestamp := timestamps[0]
+		name := fmt.Sprintf("delayed:%s", timestamp)
+		list := c.Namespace() + name
+
+		for {
+			item, err := redis.Bytes(conn.Do("LINDEX", list, 0))
+			if err == redis.ErrNil {
+				// drop the timestamp of an empty list
+				_, err = enqueueDelayedScript.Do(conn.Conn, list, schedule, "", "", "", timestamp, "", "", name, "")
+				if err != nil {
+					return enqueued, err
+				}
+				break
+			}
+			if err != nil {
+				return enqueued, err
+			}
+
+			queue, payload, err := decodeDelayedItem(item)
+			if err != nil {
+				c.logger.Error("Dropping invalid delayed job", "item", string(item), "list", name, "error", err)
+				if _, err := conn.Do("LREM", list, 1, item); err != nil {
+					return enqueued, err
+				}
+				continue
+			}
+
+			moved, err := redis.Int(enqueueDelayedScript.Do(
+				conn.Conn,
+				list,
+				schedule,
+				fmt.Sprintf("%stimestamps:%s", c.Namespace(), item),
+				c.queueKey(queue),
+				c.queuesKey(),
+				timestamp,
+				item,
+				payload,
+				name,
+				queue,
+			))
+			if err != nil {
+				return enqueued, err
+			}
+			enqueued += moved
+		}
+	}
+}
+
+// decodeDelayedItem returns the queue of a delayed job and
+// its payload in the format of the queues. Numbers are kept
+// as they are, without converting them to floats.
+func decodeDelayedItem(item []byte) (string, []byte, error) {
+	var delayed delayedItem
+	decoder := json.NewDecoder(bytes.NewReader(item))
+	decoder.UseNumber()
+	if err := decoder.Decode(&delayed); err != nil {
+		return "", nil, err
+	}
+	if delayed.Queue == "" || delayed.Class == "" {
+		return "", nil, errorInvalidDelayedItem
+	}
+	if delayed.Args == nil {
+		delayed.Args = []interface{}{}
+	}
+
+	payload, err := json.Marshal(Payload{
+		Class: delayed.Class,
+		Args:  delayed.Args,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return delayed.Queue, payload, nil
+}
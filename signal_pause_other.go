@@ -0,0 +1,14 @@
+// +build windows plan9
+
+package goworker
+
+import (
+	"os"
+)
+
+// There are no USR2 and CONT signals to pause and resume
+// with, so only Pause and Resume do.
+var (
+	pauseSignals  []os.Signal
+	resumeSignals []os.Signal
+)
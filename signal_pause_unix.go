@@ -0,0 +1,14 @@
+// +build !windows,!plan9
+
+package goworker
+
+import (
+	"os"
+	"syscall"
+)
+
+// Pausing and resuming with signals follows Resque.
+var (
+	pauseSignals  = []os.Signal{syscall.SIGUSR2}
+	resumeSignals = []os.Signal{syscall.SIGCONT}
+)
@@ -1,11 +1,27 @@
 // Signal Handling in goworker
 //
 // To stop goworker, send a QUIT, TERM, or INT
-// signal to the process. This will immediately
+// signal to the process, or cancel the context
+// passed to WorkContext. This will immediately
 // stop job polling. There can be up to
 // $CONCURRENCY jobs currently running, which
 // will continue to run until they are finished.
 //
+// With -shutdown-timeout set, running jobs get
+// only that grace period. When it expires, they
+// are cancelled and recorded as failed, or
+// pushed back to the head of their queues with
+// -shutdown-requeue, and Work returns an error.
+//
+// Like Resque, goworker stops fetching jobs on a
+// USR2 signal and fetches them again on a CONT
+// signal, letting the running jobs finish in the
+// meantime. Pause and Resume do the same from Go.
+// The poller of a paused process records the
+// time it paused under
+//
+//	resque:worker:<hostname>:<process-id>-poller:<queues>:paused
+//
 // Failure Modes
 //
 // Like Resque, goworker makes no guarantees
@@ -31,32 +47,79 @@
 //	resque:worker:<hostname>:<process-id>-<worker-id>:<queues>
 //
 // as a JSON object with keys queue, run_at, and
-// payload, but the process is manual.
+// payload. Every process refreshes its heartbeat
+// in resque:workers:heartbeat each minute, and a
+// goworker process starting later prunes the
+// workers silent for five minutes, recording
+// their jobs as failed with a DirtyExit, or
+// requeueing them with -shutdown-requeue.
 // Additionally, there is no guarantee that the
 // job in Redis under the worker key has not
 // finished, if the process is killed before
 // goworker can flush the update to Redis.
+//
+// With the -reliable flag, no job is lost this
+// way. Fetched jobs stay in an in-flight list of
+// the process until they finish, and the next
+// goworker process to start requeues the jobs
+// left behind by a killed one. A job may then
+// run twice, so workers must still be
+// idempotent.
 package goworker
 
 import (
 	"os"
 	"os/signal"
 	"syscall"
+
+	"golang.org/x/net/context"
 )
 
-func signals() <-chan bool {
+// signals returns a channel which is closed when a QUIT,
+// TERM, or INT signal is received or when ctx is done.
+func signals(ctx context.Context) <-chan bool {
 	quit := make(chan bool)
 
 	go func() {
-		signals := make(chan os.Signal)
+		signals := make(chan os.Signal, 1)
 		defer close(signals)
 
 		signal.Notify(signals, syscall.SIGQUIT, syscall.SIGTERM, os.Interrupt)
 		defer signalStop(signals)
 
-		<-signals
-		quit <- true
+		select {
+		case <-signals:
+		case <-ctx.Done():
+		}
+		close(quit)
 	}()
 
 	return quit
 }
+
+// pauseSignals pauses and resumes the client on the pause
+// and resume signals until quit is closed.
+func (c *Client) pauseSignals(quit <-chan bool) {
+	if len(pauseSignals) == 0 {
+		return
+	}
+
+	pause := make(chan os.Signal, 1)
+	signal.Notify(pause, pauseSignals...)
+	defer signalStop(pause)
+
+	resume := make(chan os.Signal, 1)
+	signal.Notify(resume, resumeSignals...)
+	defer signalStop(resume)
+
+	for {
+		select {
+		case <-pause:
+			c.Pause()
+		case <-resume:
+			c.Resume()
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package goworker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	errorEmptyTimeoutName = errors.New("the timeout must be given for a name, e.g. MyClass=30s")
+	errorInvalidTimeout   = errors.New("the timeout must be a positive duration, e.g. 30s")
+)
+
+// timeoutsFlag maps job classes or queues to the longest
+// time their jobs may run, e.g. -class-timeouts='MyClass=30s'.
+type timeoutsFlag map[string]time.Duration
+
+func (t *timeoutsFlag) Set(value string) error {
+	for _, nameAndTimeout := range strings.Split(value, ",") {
+		if nameAndTimeout == "" {
+			continue
+		}
+
+		parts := strings.SplitN(nameAndTimeout, "=", 2)
+		if parts[0] == "" || len(parts) == 1 {
+			return errorEmptyTimeoutName
+		}
+		timeout, err := time.ParseDuration(parts[1])
+		if err != nil || timeout <= 0 {
+			return errorInvalidTimeout
+		}
+
+		if *t == nil {
+			*t = make(timeoutsFlag)
+		}
+		(*t)[parts[0]] = timeout
+	}
+	return nil
+}
+
+func (t *timeoutsFlag) String() string {
+	names := make([]string, 0, len(*t))
+	for name := range *t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	timeouts := make([]string, len(names))
+	for i, name := range names {
+		timeouts[i] = fmt.Sprintf("%s=%v", name, (*t)[name])
+	}
+	return strings.Join(timeouts, ",")
+}
@@ -0,0 +1,71 @@
+package goworker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var timeoutsFlagSetTests = []struct {
+	v        string
+	expected timeoutsFlag
+	err      error
+}{
+	{
+		"",
+		nil,
+		nil,
+	},
+	{
+		"MyClass=30s",
+		timeoutsFlag{"MyClass": 30 * time.Second},
+		nil,
+	},
+	{
+		"MyClass=30s,,Other=1m30s",
+		timeoutsFlag{"MyClass": 30 * time.Second, "Other": 90 * time.Second},
+		nil,
+	},
+	{
+		"MyClass",
+		nil,
+		errorEmptyTimeoutName,
+	},
+	{
+		"=30s",
+		nil,
+		errorEmptyTimeoutName,
+	},
+	{
+		"MyClass=30",
+		nil,
+		errorInvalidTimeout,
+	},
+	{
+		"MyClass=-1s",
+		nil,
+		errorInvalidTimeout,
+	},
+}
+
+func TestTimeoutsFlagSet(t *testing.T) {
+	for _, tt := range timeoutsFlagSetTests {
+		var actual timeoutsFlag
+		err := actual.Set(tt.v)
+		if err != tt.err {
+			t.Errorf("TimeoutsFlag: set to %s expected err %v, actual err %v", tt.v, tt.err, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("TimeoutsFlag: set to %s expected %v, actual %v", tt.v, tt.expected, actual)
+		}
+	}
+}
+
+func TestTimeoutsFlagString(t *testing.T) {
+	actual := timeoutsFlag{"Other": time.Minute, "MyClass": 30 * time.Second}
+	expected := "MyClass=30s,Other=1m0s"
+	if actual.String() != expected {
+		t.Errorf("TimeoutsFlag(%#v): expected %s, actual %s", actual, expected, actual.String())
+	}
+}
@@ -0,0 +1,53 @@
+package goworker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+var (
+	errorTLSKeyPair = errors.New("TLS client certificate and key must be set together")
+	errorTLSCA      = errors.New("no certificates found in the TLS CA bundle")
+)
+
+// tlsConfig builds the TLS configuration for rediss:// and
+// rediss+sentinel:// URIs from the worker settings. It
+// returns nil when no TLS option is set, so that the
+// defaults of the Redis client apply.
+func (s *WorkerSettings) tlsConfig() (*tls.Config, error) {
+	if s.TLSCAFile == "" && s.TLSCertFile == "" && s.TLSKeyFile == "" &&
+		s.TLSServerName == "" && !s.TLSSkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         s.TLSServerName,
+		InsecureSkipVerify: s.TLSSkipVerify,
+	}
+
+	if s.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(s.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errorTLSCA
+		}
+	}
+
+	if s.TLSCertFile != "" || s.TLSKeyFile != "" {
+		if s.TLSCertFile == "" || s.TLSKeyFile == "" {
+			return nil, errorTLSKeyPair
+		}
+		cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,50 @@
+package goworker
+
+import (
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	for _, tt := range []struct {
+		settings      WorkerSettings
+		expectNil     bool
+		expectedError error
+	}{
+		{
+			settings:  WorkerSettings{},
+			expectNil: true,
+		},
+		{
+			settings: WorkerSettings{TLSServerName: "redis.example.com", TLSSkipVerify: true},
+		},
+		{
+			settings:      WorkerSettings{TLSCertFile: "cert.pem"},
+			expectNil:     true,
+			expectedError: errorTLSKeyPair,
+		},
+		{
+			settings:      WorkerSettings{TLSKeyFile: "key.pem"},
+			expectNil:     true,
+			expectedError: errorTLSKeyPair,
+		},
+	} {
+		config, err := tt.settings.tlsConfig()
+		if err != tt.expectedError {
+			t.Errorf("%#v: expected error %v, actual %v", tt.settings, tt.expectedError, err)
+		}
+		if (config == nil) != tt.expectNil {
+			t.Errorf("%#v: expected nil config %v, actual %#v", tt.settings, tt.expectNil, config)
+			continue
+		}
+		if config != nil && (config.ServerName != tt.settings.TLSServerName || config.InsecureSkipVerify != tt.settings.TLSSkipVerify) {
+			t.Errorf("%#v: unexpected config %#v", tt.settings, config)
+		}
+	}
+}
+
+func TestTLSConfigMissingCA(t *testing.T) {
+	settings := WorkerSettings{TLSCAFile: "/nonexistent/ca.pem"}
+	if _, err := settings.tlsConfig(); err == nil {
+		t.Error("expected an error for a missing CA bundle")
+	}
+}
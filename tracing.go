@@ -0,0 +1,161 @@
+package goworker
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+)
+
+const tracerName = "github.com/EnerfisTeam/goworker"
+
+// propagator carries the W3C trace context and baggage in
+// the trace_context field of payloads, which Resque
+// ignores.
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+func (c *Client) tracer() trace.Tracer {
+	provider := c.settings.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// injectTraceContext returns the payload carrying the trace
+// context of ctx. The payload is returned as it is when ctx
+// carries no trace.
+func injectTraceContext(ctx context.Context, payload Payload) Payload {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		payload.TraceContext = carrier
+	}
+	return payload
+}
+
+// trace is the built-in middleware which runs the job in a
+// span, continuing the trace of the code which enqueued it.
+func (w *worker) trace(next Handler) Handler {
+	return func(ctx context.Context, job *Job) error {
+		if len(job.Payload.TraceContext) > 0 {
+			ctx = propagator.Extract(ctx, propagation.MapCarrier(job.Payload.TraceContext))
+		}
+		ctx, span := w.client.tracer().Start(
+			ctx,
+			job.Payload.Class,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "resque"),
+				attribute.String("messaging.operation", "process"),
+				attribute.String("messaging.destination.name", job.Queue),
+				attribute.String("goworker.job.class", job.Payload.Class),
+			),
+		)
+		defer span.End()
+		if job.attempt > 0 {
+			span.SetAttributes(attribute.Int("goworker.job.attempt", job.attempt))
+		}
+
+		err := next(ctx, job)
+
+		span.SetAttributes(attribute.String("goworker.job.outcome", outcome(err)))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// outcome names the result of a job for its span.
+func outcome(err error) string {
+	switch err.(type) {
+	case nil:
+		return "success"
+	case *TimeoutError:
+		return "timeout"
+	case *PanicError:
+		return "panic"
+	}
+	return "failure"
+}
+
+// GetConnContext returns a connection from the pool of the
+// default client, tracing it within ctx.
+func GetConnContext(ctx context.Context) (*RedisConn, error) {
+	return defaultClient.GetConnContext(ctx)
+}
+
+// GetConnContext returns a connection from the pool like
+// GetConn. With TraceRedis, getting the connection and every
+// command sent with Do appear as child spans of the span in
+// ctx. Put the connection back with PutConn as usual.
+func (c *Client) GetConnContext(ctx context.Context) (*RedisConn, error) {
+	if !c.settings.TraceRedis {
+		return c.GetConn()
+	}
+
+	_, span := c.tracer().Start(ctx, "GetConn", trace.WithSpanKind(trace.SpanKindClient))
+	conn, err := c.GetConn()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+	span.End()
+
+	return &RedisConn{Conn: &tracedConn{Conn: conn.Conn, pooled: conn, ctx: ctx, tracer: c.tracer()}}, nil
+}
+
+// tracedConn traces the commands sent with Do on a pooled
+// connection.
+type tracedConn struct {
+	redis.Conn
+	pooled *RedisConn
+	ctx    context.Context
+	tracer trace.Tracer
+}
+
+func (t *tracedConn) Do(command string, args ...interface{}) (interface{}, error) {
+	if command == "" {
+		// flushing a pipeline
+		return t.Conn.Do(command, args...)
+	}
+
+	_, span := t.tracer.Start(
+		t.ctx,
+		command,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", command),
+		),
+	)
+	defer span.End()
+
+	reply, err := t.Conn.Do(command, args...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return reply, err
+}
+
+// untraced returns the pooled connection of a traced one.
+func untraced(conn *RedisConn) *RedisConn {
+	if conn == nil {
+		return nil
+	}
+	if traced, ok := conn.Conn.(*tracedConn); ok {
+		return traced.pooled
+	}
+	return conn
+}
@@ -0,0 +1,110 @@
+package goworker
+
+import (
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+)
+
+func testSpanContext(t *testing.T) trace.SpanContext {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+func TestInjectTraceContext(t *testing.T) {
+	ctx := trace.ContextWithSpanContext(context.Background(), testSpanContext(t))
+	payload := injectTraceContext(ctx, Payload{Class: "MyClass"})
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if actual := payload.TraceContext["traceparent"]; actual != expected {
+		t.Errorf("expected traceparent %s, actual %s", expected, actual)
+	}
+
+	existing := map[string]string{"traceparent": expected}
+	payload = injectTraceContext(context.Background(), Payload{Class: "MyClass", TraceContext: existing})
+	if payload.TraceContext["traceparent"] != expected {
+		t.Errorf("expected the trace context to be kept without a trace, actual %v", payload.TraceContext)
+	}
+}
+
+func TestWorkerTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	w := newTestWorker()
+	w.client.settings.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ctx := trace.ContextWithSpanContext(context.Background(), testSpanContext(t))
+	job := &Job{Queue: "high", Payload: injectTraceContext(ctx, Payload{Class: "MyClass"}), attempt: 2}
+
+	failed := errors.New("failed")
+	err := w.trace(func(ctx context.Context, job *Job) error {
+		if !trace.SpanFromContext(ctx).IsRecording() {
+			t.Error("expected the job to run in a recording span")
+		}
+		return failed
+	})(context.Background(), job)
+	if err != failed {
+		t.Errorf("expected error %v, actual %v", failed, err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, actual %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "MyClass" || span.SpanKind() != trace.SpanKindConsumer {
+		t.Errorf("expected a consumer span MyClass, actual %s %v", span.Name(), span.SpanKind())
+	}
+	if span.Parent().TraceID() != testSpanContext(t).TraceID() || !span.Parent().IsRemote() {
+		t.Errorf("expected the span to continue the trace of the payload, actual parent %v", span.Parent())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("expected error status, actual %v", span.Status())
+	}
+
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	for key, expected := range map[attribute.Key]attribute.Value{
+		"messaging.destination.name": attribute.StringValue("high"),
+		"goworker.job.class":         attribute.StringValue("MyClass"),
+		"goworker.job.attempt":       attribute.IntValue(2),
+		"goworker.job.outcome":       attribute.StringValue("failure"),
+	} {
+		if attributes[key] != expected {
+			t.Errorf("%s: expected %v, actual %v", key, expected.Emit(), attributes[key].Emit())
+		}
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	for _, tt := range []struct {
+		err      error
+		expected string
+	}{
+		{nil, "success"},
+		{&TimeoutError{}, "timeout"},
+		{&PanicError{Value: "boom"}, "panic"},
+		{errors.New("failed"), "failure"},
+	} {
+		if actual := outcome(tt.err); actual != tt.expected {
+			t.Errorf("%v: expected %s, actual %s", tt.err, tt.expected, actual)
+		}
+	}
+}
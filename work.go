@@ -8,4 +8,7 @@ type work struct {
 	Queue   string    `json:"queue"`
 	RunAt   time.Time `json:"run_at"`
 	Payload Payload   `json:"payload"`
+	// Reliable tells the job is kept in an in-flight list,
+	// which recovers it if the worker dies.
+	Reliable bool `json:"reliable,omitempty"`
 }
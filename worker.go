@@ -6,14 +6,30 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
+var errorShutdownCancelled = errors.New("job cancelled after the shutdown grace period expired")
+
+// TimeoutError is recorded as the failure of a job which
+// ran longer than the timeout of its class or queue.
+type TimeoutError struct {
+	Class   string
+	Queue   string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("job %s on %s timed out after %v", e.Class, e.Queue, e.Timeout)
+}
+
 type worker struct {
 	process
 }
 
-func newWorker(id string, queues []string) (*worker, error) {
-	process, err := newProcess(id, queues)
+func newWorker(client *Client, id string, queues []string) (*worker, error) {
+	process, err := newProcess(client, id, queues)
 	if err != nil {
 		return nil, err
 	}
@@ -28,9 +44,10 @@ func (w *worker) MarshalJSON() ([]byte, error) {
 
 func (w *worker) start(conn *RedisConn, job *Job) error {
 	work := &work{
-		Queue:   job.Queue,
-		RunAt:   time.Now(),
-		Payload: job.Payload,
+		Queue:    job.Queue,
+		RunAt:    time.Now(),
+		Payload:  job.Payload,
+		Reliable: w.client.settings.Reliable,
 	}
 
 	buffer, err := json.Marshal(work)
@@ -38,8 +55,8 @@ func (w *worker) start(conn *RedisConn, job *Job) error {
 		return err
 	}
 
-	conn.Send("SET", fmt.Sprintf("%sworker:%s", workerSettings.Namespace, w), buffer)
-	logger.Debugf("Processing %s since %s [%v]", work.Queue, work.RunAt, work.Payload.Class)
+	conn.Send("SET", fmt.Sprintf("%sworker:%s", w.client.Namespace(), w), buffer)
+	w.client.logger.Debug("Processing job", w.jobFields(job)...)
 
 	return w.process.start(conn)
 }
@@ -48,8 +65,9 @@ func (w *worker) fail(conn *RedisConn, job *Job, err error) error {
 	failure := &failure{
 		FailedAt:  time.Now(),
 		Payload:   job.Payload,
-		Exception: "Error",
+		Exception: exception(err),
 		Error:     err.Error(),
+		Backtrace: backtrace(err),
 		Worker:    w,
 		Queue:     job.Queue,
 	}
@@ -57,35 +75,39 @@ func (w *worker) fail(conn *RedisConn, job *Job, err error) error {
 	if err != nil {
 		return err
 	}
-	conn.Send("RPUSH", fmt.Sprintf("%sfailed", workerSettings.Namespace), buffer)
+	conn.Send("RPUSH", fmt.Sprintf("%sfailed", w.client.Namespace()), buffer)
 
 	return w.process.fail(conn)
 }
 
 func (w *worker) succeed(conn *RedisConn, job *Job) error {
-	conn.Send("INCR", fmt.Sprintf("%sstat:processed", workerSettings.Namespace))
-	conn.Send("INCR", fmt.Sprintf("%sstat:processed:%s", workerSettings.Namespace, w))
+	conn.Send("INCR", fmt.Sprintf("%sstat:processed", w.client.Namespace()))
+	conn.Send("INCR", fmt.Sprintf("%sstat:processed:%s", w.client.Namespace(), w))
 
 	return nil
 }
 
 func (w *worker) finish(conn *RedisConn, job *Job, err error) error {
 	if err != nil {
-		w.fail(conn, job, err)
+		if !w.retry(conn, job, err) {
+			w.fail(conn, job, err)
+		}
 	} else {
+		w.forgetAttempts(conn, job)
 		w.succeed(conn, job)
 	}
+	w.ack(conn, job)
 	return w.process.finish(conn)
 }
 
-func (w *worker) work(jobs <-chan *Job, monitor *sync.WaitGroup) {
-	conn, err := GetConn()
+func (w *worker) work(ctx context.Context, jobs <-chan *Job, monitor *sync.WaitGroup) {
+	conn, err := w.client.GetConn()
 	if err != nil {
-		logger.Criticalf("Error on getting connection in worker %v: %v", w, err)
+		w.client.logger.Error("Error on getting connection in worker", w.fields("error", err)...)
 		return
 	} else {
 		w.open(conn)
-		PutConn(conn)
+		w.client.PutConn(conn)
 	}
 
 	monitor.Add(1)
@@ -94,63 +116,77 @@ func (w *worker) work(jobs <-chan *Job, monitor *sync.WaitGroup) {
 		defer func() {
 			defer monitor.Done()
 
-			conn, err := GetConn()
+			conn, err := w.client.GetConn()
 			if err != nil {
-				logger.Criticalf("Error on getting connection in worker %v: %v", w, err)
+				w.client.logger.Error("Error on getting connection in worker", w.fields("error", err)...)
 				return
 			} else {
 				w.close(conn)
-				PutConn(conn)
+				w.client.PutConn(conn)
 			}
 		}()
 		for job := range jobs {
-			if workerFunc, ok := workers[job.Payload.Class]; ok {
-				w.run(job, workerFunc)
-
-				logger.Debugf("done: (Job{%s} | %s | %v)", job.Queue, job.Payload.Class, job.Payload.Args)
+			if handler, ok := w.client.workers[job.Payload.Class]; ok {
+				w.run(ctx, job, handler)
 			} else {
 				errorLog := fmt.Sprintf("No worker for %s in queue %s with args %v", job.Payload.Class, job.Queue, job.Payload.Args)
-				logger.Critical(errorLog)
+				w.client.logger.Error("No worker for job", w.jobFields(job, "args", job.Payload.Args)...)
 
-				conn, err := GetConn()
+				conn, err := w.client.GetConn()
 				if err != nil {
-					logger.Criticalf("Error on getting connection in worker %v: %v", w, err)
+					w.client.logger.Error("Error on getting connection in worker", w.jobFields(job, "error", err)...)
 					return
 				} else {
 					w.finish(conn, job, errors.New(errorLog))
-					PutConn(conn)
+					w.client.PutConn(conn)
 				}
 			}
 		}
 	}()
 }
 
-func (w *worker) run(job *Job, workerFunc workerFunc) {
-	var err error
-	defer func() {
-		conn, errCon := GetConn()
-		if errCon != nil {
-			logger.Criticalf("Error on getting connection in worker on finish %v: %v", w, errCon)
-			return
-		} else {
-			w.finish(conn, job, err)
-			PutConn(conn)
-		}
-	}()
-	defer func() {
-		if r := recover(); r != nil {
-			err = errors.New(fmt.Sprint(r))
-			logger.Critical(err)
-		}
+// run runs the job through the built-in middleware and the
+// middleware added to the client.
+func (w *worker) run(ctx context.Context, job *Job, handler Handler) {
+	handler = w.client.chain(job.Payload.Class, handler)
+	w.recordFailures(w.trace(w.forkHooks(w.performHooks(w.limitTime(handler)))))(ctx, job)
+}
+
+// call runs the handler, recovering its panics, and waits
+// for it until ctx is done. A handler that does not return
+// by then keeps running in the background, but its outcome
+// is ignored and the worker moves on to the next job.
+func (w *worker) call(ctx context.Context, job *Job, handler Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	handler = w.recoverPanics(handler)
+	done := make(chan error, 1)
+	go func() {
+		done <- handler(ctx, job)
 	}()
 
-	conn, err := GetConn()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// abandon pushes a cancelled job back to its queue and
+// clears the worker state.
+func (w *worker) abandon(job *Job) {
+	conn, err := w.client.GetConn()
 	if err != nil {
-		logger.Criticalf("Error on getting connection in worker on start %v: %v", w, err)
+		w.client.logger.Error("Error on getting connection in worker on requeue", w.jobFields(job, "error", err)...)
 		return
-	} else {
-		w.start(conn, job)
-		PutConn(conn)
 	}
-	err = workerFunc(job.Queue, job.Payload.Args...)
+	defer w.client.PutConn(conn)
+
+	w.client.logger.Info("Requeueing job cancelled by shutdown", w.jobFields(job)...)
+	if err := w.requeue(conn, job); err != nil {
+		w.client.logger.Error("Error requeueing job", w.jobFields(job, "error", err)...)
+	}
+	w.process.finish(conn)
 }
@@ -1,3 +1,20 @@
 package goworker
 
+import (
+	"golang.org/x/net/context"
+)
+
 type workerFunc func(string, ...interface{}) error
+
+// Handler is a context-aware worker function. It receives
+// the whole job, and its context is cancelled when the job
+// is abandoned, i.e. when its timeout or the shutdown grace
+// period expires.
+type Handler func(ctx context.Context, job *Job) error
+
+// handler adapts a plain worker function to a Handler.
+func (f workerFunc) handler() Handler {
+	return func(ctx context.Context, job *Job) error {
+		return f(job.Queue, job.Payload.Args...)
+	}
+}
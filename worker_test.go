@@ -1,9 +1,13 @@
 package goworker
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/cihub/seelog"
+	"golang.org/x/net/context"
 )
 
 var workerMarshalJSONTests = []struct {
@@ -40,6 +44,75 @@ func TestWorkerMarshalJSON(t *testing.T) {
 	}
 }
 
+func newTestWorker() *worker {
+	client := NewClient(WorkerSettings{})
+	client.logger = SeelogLogger(seelog.Disabled)
+	return &worker{process: process{client: client}}
+}
+
+func TestWorkerCall(t *testing.T) {
+	w := newTestWorker()
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass", Args: []interface{}{"hi"}}}
+	expected := errors.New("failed")
+
+	for _, tt := range []struct {
+		f        workerFunc
+		expected string
+	}{
+		{func(string, ...interface{}) error { return nil }, ""},
+		{func(string, ...interface{}) error { return expected }, "failed"},
+		{func(string, ...interface{}) error { panic("boom") }, "boom"},
+	} {
+		err := w.call(context.Background(), job, tt.f.handler())
+		if (err == nil && tt.expected != "") || (err != nil && err.Error() != tt.expected) {
+			t.Errorf("expected error %q, actual %v", tt.expected, err)
+		}
+	}
+}
+
+func TestWorkerCallCancelled(t *testing.T) {
+	w := newTestWorker()
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+	block := make(chan struct{})
+	defer close(block)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	err := w.call(ctx, job, func(ctx context.Context, job *Job) error {
+		<-block
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expected %v, actual %v", context.Canceled, err)
+	}
+}
+
+func TestWorkerCallPassesContext(t *testing.T) {
+	w := newTestWorker()
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+
+	var handlerCtx context.Context
+	err := w.call(context.Background(), job, func(ctx context.Context, actual *Job) error {
+		if actual != job {
+			t.Errorf("expected job %v, actual %v", job, actual)
+		}
+		handlerCtx = ctx
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-handlerCtx.Done():
+	default:
+		t.Error("expected the job context to be cancelled after the job finished")
+	}
+}
+
 func TestEnqueue(t *testing.T) {
 	dockerComposeUp(t)
 	setup := scanSetup(t)
@@ -89,3 +162,64 @@ func TestEnqueue(t *testing.T) {
 		t.Errorf("(Enqueue) Expected %v, actual %v", actualQueueName, queueName)
 	}
 }
+
+func TestClientChain(t *testing.T) {
+	client := NewClient(WorkerSettings{})
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, job *Job) error {
+				calls = append(calls, name)
+				return next(ctx, job)
+			}
+		}
+	}
+	client.Use(trace("global1"), trace("global2"))
+	client.UseClass("MyClass", trace("class1"))
+	client.UseClass("MyClass", trace("class2"))
+	client.UseClass("OtherClass", trace("other"))
+
+	handler := client.chain("MyClass", func(ctx context.Context, job *Job) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	if err := handler(context.Background(), &Job{Payload: Payload{Class: "MyClass"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"global1", "global2", "class1", "class2", "handler"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, actual %v", expected, calls)
+	}
+}
+
+func TestWorkerCallRecoversMiddlewarePanics(t *testing.T) {
+	w := newTestWorker()
+	w.client.Use(func(next Handler) Handler {
+		return func(ctx context.Context, job *Job) error {
+			panic("middleware")
+		}
+	})
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+
+	handler := w.client.chain(job.Payload.Class, func(ctx context.Context, job *Job) error { return nil })
+	err := w.call(context.Background(), job, handler)
+	if _, ok := err.(*PanicError); !ok || err.Error() != "middleware" {
+		t.Errorf("expected a PanicError of the middleware, actual %#v", err)
+	}
+}
+
+func TestWorkerLimitTime(t *testing.T) {
+	w := newTestWorker()
+	w.client.settings.ClassTimeouts = timeoutsFlag{"MyClass": 10 * time.Millisecond}
+	job := &Job{Queue: "high", Payload: Payload{Class: "MyClass"}}
+
+	err := w.limitTime(func(ctx context.Context, job *Job) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})(context.Background(), job)
+	timeoutErr, ok := err.(*TimeoutError)
+	if !ok || timeoutErr.Timeout != 10*time.Millisecond {
+		t.Errorf("expected a TimeoutError after 10ms, actual %#v", err)
+	}
+}
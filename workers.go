@@ -2,48 +2,98 @@ package goworker
 
 import (
 	"encoding/json"
-	"fmt"
-)
 
-var (
-	workers map[string]workerFunc
+	"golang.org/x/net/context"
 )
 
-func init() {
-	workers = make(map[string]workerFunc)
-}
-
 // Register registers a goworker worker function. Class
 // refers to the Ruby name of the class which enqueues the
 // job. Worker is a function which accepts a queue and an
 // arbitrary array of interfaces as arguments.
 func Register(class string, worker workerFunc) {
-	workers[class] = worker
+	defaultClient.Register(class, worker)
+}
+
+// Register registers a goworker worker function with the
+// client. Class refers to the Ruby name of the class which
+// enqueues the job. Worker is a function which accepts a
+// queue and an arbitrary array of interfaces as arguments.
+func (c *Client) Register(class string, worker workerFunc) {
+	c.workers[class] = worker.handler()
 }
 
+// RegisterContext registers a context-aware worker function.
+// Class refers to the Ruby name of the class which enqueues
+// the job. The handler receives the job and a context which
+// is cancelled when the job is abandoned.
+func RegisterContext(class string, handler Handler) {
+	defaultClient.RegisterContext(class, handler)
+}
+
+// RegisterContext registers a context-aware worker function
+// with the client.
+func (c *Client) RegisterContext(class string, handler Handler) {
+	c.workers[class] = handler
+}
+
+// Enqueue pushes the job onto its queue through the
+// default client.
 func Enqueue(job *Job) error {
-	err := Init()
+	return defaultClient.Enqueue(job)
+}
+
+// EnqueueContext pushes the job onto its queue through the
+// default client, propagating the trace of ctx.
+func EnqueueContext(ctx context.Context, job *Job) error {
+	return defaultClient.EnqueueContext(ctx, job)
+}
+
+// Enqueue pushes the job onto its queue. The BeforeEnqueue
+// hooks of the job may abort it, in which case Enqueue
+// returns nil without pushing it.
+func (c *Client) Enqueue(job *Job) error {
+	return c.EnqueueContext(context.Background(), job)
+}
+
+// EnqueueContext pushes the job onto its queue like Enqueue,
+// and records the trace context of ctx in the payload, so
+// that the job continues the trace when it runs.
+func (c *Client) EnqueueContext(ctx context.Context, job *Job) error {
+	err := c.Init()
 	if err != nil {
 		return err
 	}
 
-	conn, err := GetConn()
+	if err := c.beforeEnqueue(job); err != nil {
+		if err == ErrDontPerform {
+			c.logger.Info("Not enqueueing job aborted by a hook", jobFields(job)...)
+			return nil
+		}
+		return err
+	}
+
+	conn, err := c.GetConn()
 	if err != nil {
-		logger.Criticalf("Error on getting connection on enqueue")
+		c.logger.Error("Error on getting connection on enqueue", jobFields(job, "error", err)...)
 		return err
 	}
-	defer PutConn(conn)
+	defer c.PutConn(conn)
 
-	buffer, err := json.Marshal(job.Payload)
+	buffer, err := json.Marshal(injectTraceContext(ctx, job.Payload))
 	if err != nil {
-		logger.Criticalf("Cant marshal payload on enqueue")
+		c.logger.Error("Cant marshal payload on enqueue", jobFields(job, "error", err)...)
 		return err
 	}
-	err = conn.Send("RPUSH", fmt.Sprintf("%squeue:%s", workerSettings.Namespace, job.Queue), buffer)
+	conn.Send("SADD", c.queuesKey(), job.Queue)
+	err = conn.Send("RPUSH", c.queueKey(job.Queue), buffer)
 	if err != nil {
-		logger.Criticalf("Cant push to queue")
+		c.logger.Error("Cant push to queue", jobFields(job, "error", err)...)
+		return err
+	}
+	if err := conn.Flush(); err != nil {
 		return err
 	}
 
-	return conn.Flush()
+	c.afterEnqueue(job)
+	return nil
 }